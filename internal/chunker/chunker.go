@@ -2,11 +2,9 @@ package chunker
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"github.com/opencontainers/go-digest"
-	"gvisor.dev/gvisor/pkg/sync"
-	"hash"
 	"io"
+	"os"
 )
 
 // InitializeWriterFunc should initialize a new io.WriteCloser on each invocation,
@@ -14,127 +12,44 @@ import (
 // write the output to the outputWriter.
 type InitializeWriterFunc func(outputWriter io.Writer) (io.WriteCloser, error)
 
-type Chunker struct {
-	// Settings
-	chunkSize        int
-	initializeWriter InitializeWriterFunc
-
-	// State
-	chunks  chan *Chunk
-	emitted bool
-
-	// Per-chunk state
-	buf              *bytes.Buffer
-	uncompressedSize int64
-	uncompressedHash hash.Hash
-	writer           io.WriteCloser
+type Chunk struct {
+	// Data holds the chunk's contents when no spool directory is used
+	Data []byte
 
-	// State protection
-	mtx sync.Mutex
-}
+	// Path points to a file with the chunk's contents when the spool
+	// directory is used, it's up to the caller to remove this file
+	Path string
 
-type Chunk struct {
-	Data               []byte
+	Size               int64
+	Digest             digest.Digest
 	UncompressedSize   int64
 	UncompressedDigest digest.Digest
 }
 
-func NewChunker(chunkSize int, initializeWriter InitializeWriterFunc) (*Chunker, error) {
-	chunker := &Chunker{
-		// Settings
-		chunkSize:        chunkSize,
-		initializeWriter: initializeWriter,
-
-		// State
-		chunks: make(chan *Chunk),
-	}
-
-	if err := chunker.resetPerChunkState(); err != nil {
-		return nil, err
-	}
-
-	return chunker, nil
-}
-
-func (chunker *Chunker) Write(b []byte) (int, error) {
-	chunker.mtx.Lock()
-	defer chunker.mtx.Unlock()
-
-	// Have we reached the target chunk size?
-	if chunker.buf.Len() >= chunker.chunkSize {
-		// We need to Close() the chunker.writer first before emitting a chunk,
-		// otherwise the un-flushed state in the chunker.writer that it should
-		// write to chunker.buf might be lost
-		if err := chunker.writer.Close(); err != nil {
-			return 0, err
-		}
-
-		// Emit a new chunk, blocking any new Write()'s
-		// to prevent memory starvation
-		chunker.chunks <- &Chunk{
-			Data:               chunker.buf.Bytes(),
-			UncompressedSize:   chunker.uncompressedSize,
-			UncompressedDigest: digest.NewDigest(digest.SHA256, chunker.uncompressedHash),
-		}
-		chunker.emitted = true
-
-		if err := chunker.resetPerChunkState(); err != nil {
-			return 0, err
-		}
+// Open returns a reader for the chunk's contents regardless
+// of whether the chunk was spooled to disk or not.
+func (chunk *Chunk) Open() (io.ReadSeekCloser, error) {
+	if chunk.Path != "" {
+		return os.Open(chunk.Path)
 	}
 
-	// Update uncompressed chunk size
-	chunker.uncompressedSize += int64(len(b))
-
-	// Update uncompressed chunk hash
-	n, err := chunker.uncompressedHash.Write(b)
-	if err != nil {
-		return n, err
-	}
-
-	return chunker.writer.Write(b)
+	return nopCloser{bytes.NewReader(chunk.Data)}, nil
 }
 
-func (chunker *Chunker) Chunks() chan *Chunk {
-	return chunker.chunks
+type counter struct {
+	n *int64
 }
 
-func (chunker *Chunker) Close() error {
-	chunker.mtx.Lock()
-	defer chunker.mtx.Unlock()
-
-	// We need to Close() the chunker.writer first before emitting a chunk,
-	// otherwise the un-flushed state in the chunker.writer that it should
-	// write to chunker.buf might be lost
-	if err := chunker.writer.Close(); err != nil {
-		return err
-	}
+func (counter *counter) Write(b []byte) (int, error) {
+	*counter.n += int64(len(b))
 
-	// Only emit a last chunk if we have some data available
-	// or there were no chunks emitted before
-	if chunker.buf.Len() != 0 || !chunker.emitted {
-		chunker.chunks <- &Chunk{
-			Data:               chunker.buf.Bytes(),
-			UncompressedSize:   chunker.uncompressedSize,
-			UncompressedDigest: digest.NewDigest(digest.SHA256, chunker.uncompressedHash),
-		}
-	}
-
-	close(chunker.chunks)
-
-	return chunker.resetPerChunkState()
+	return len(b), nil
 }
 
-func (chunker *Chunker) resetPerChunkState() error {
-	chunker.buf = &bytes.Buffer{}
-	chunker.uncompressedSize = 0
-	chunker.uncompressedHash = sha256.New()
-
-	writer, err := chunker.initializeWriter(chunker.buf)
-	if err != nil {
-		return err
-	}
-	chunker.writer = writer
+type nopCloser struct {
+	io.ReadSeeker
+}
 
+func (nopCloser) Close() error {
 	return nil
 }
@@ -0,0 +1,96 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Windows splits a file of the specified size into fixed-size windows,
+// returning their offsets. At least one window is always returned,
+// even for empty files, so that the file can be represented by a chunk.
+func Windows(size int64, windowSize int64) []int64 {
+	result := []int64{0}
+
+	for offset := windowSize; offset < size; offset += windowSize {
+		result = append(result, offset)
+	}
+
+	return result
+}
+
+// NewWindowChunk produces a single chunk from a fixed-offset window of the src,
+// which makes it possible to process multiple windows of the same file in parallel.
+//
+// The chunk is written to a temporary file in the spoolDir,
+// or kept in memory if the spoolDir is empty.
+func NewWindowChunk(
+	src io.ReaderAt,
+	offset int64,
+	size int64,
+	initializeWriter InitializeWriterFunc,
+	spoolDir string,
+) (*Chunk, error) {
+	var buf *bytes.Buffer
+	var file *os.File
+	var output io.Writer
+
+	if spoolDir != "" {
+		var err error
+
+		file, err = os.CreateTemp(spoolDir, "chunk-*")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		output = file
+	} else {
+		buf = &bytes.Buffer{}
+		output = buf
+	}
+
+	var compressedSize int64
+	compressedHash := sha256.New()
+
+	writer, err := initializeWriter(io.MultiWriter(output, compressedHash, &counter{&compressedSize}))
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressedHash := sha256.New()
+
+	uncompressedSize, err := io.Copy(io.MultiWriter(writer, uncompressedHash),
+		io.NewSectionReader(src, offset, size))
+	if err != nil {
+		return nil, err
+	}
+
+	// We need to Close() the writer first before emitting a chunk,
+	// otherwise the un-flushed state in the writer might be lost
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	chunk := &Chunk{
+		Size:               compressedSize,
+		Digest:             digest.NewDigest(digest.SHA256, compressedHash),
+		UncompressedSize:   uncompressedSize,
+		UncompressedDigest: digest.NewDigest(digest.SHA256, uncompressedHash),
+	}
+
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return nil, err
+		}
+
+		chunk.Path = file.Name()
+	} else {
+		chunk.Data = buf.Bytes()
+	}
+
+	return chunk, nil
+}
@@ -0,0 +1,74 @@
+package chunker_test
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	chunkerpkg "github.com/cirruslabs/vetu/internal/chunker"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindows(t *testing.T) {
+	require.Equal(t, []int64{0}, chunkerpkg.Windows(0, 10))
+	require.Equal(t, []int64{0}, chunkerpkg.Windows(10, 10))
+	require.Equal(t, []int64{0, 10}, chunkerpkg.Windows(11, 10))
+	require.Equal(t, []int64{0, 10, 20}, chunkerpkg.Windows(25, 10))
+}
+
+func TestWindowChunk(t *testing.T) {
+	const windowSize = 1 * 1024 * 1024
+
+	data, err := io.ReadAll(io.LimitReader(cryptorand.Reader, 2*windowSize+windowSize/2))
+	require.NoError(t, err)
+
+	for _, spoolDir := range []string{"", t.TempDir()} {
+		var actualData []byte
+
+		for _, offset := range chunkerpkg.Windows(int64(len(data)), windowSize) {
+			chunk, err := chunkerpkg.NewWindowChunk(bytes.NewReader(data), offset, windowSize,
+				func(w io.Writer) (io.WriteCloser, error) {
+					return WriteNopCloser(w), nil
+				}, spoolDir)
+			require.NoError(t, err)
+
+			reader, err := chunk.Open()
+			require.NoError(t, err)
+
+			chunkData, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+
+			if spoolDir != "" {
+				require.NoError(t, os.Remove(chunk.Path))
+			}
+
+			expectedData := data[offset:min(offset+windowSize, int64(len(data)))]
+
+			require.Equal(t, expectedData, chunkData)
+			require.EqualValues(t, len(expectedData), chunk.Size)
+			require.EqualValues(t, len(expectedData), chunk.UncompressedSize)
+			require.Equal(t, digest.FromBytes(expectedData), chunk.Digest)
+			require.Equal(t, digest.FromBytes(expectedData), chunk.UncompressedDigest)
+
+			actualData = append(actualData, chunkData...)
+		}
+
+		require.Equal(t, data, actualData)
+	}
+}
+
+type writeNopCloser struct {
+	io.Writer
+}
+
+func WriteNopCloser(w io.Writer) io.WriteCloser {
+	return &writeNopCloser{w}
+}
+
+func (nopCloser *writeNopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,157 @@
+package attach
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vfio"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/spf13/cobra"
+)
+
+var ErrAttach = errors.New("failed to attach to the VM")
+
+var disk string
+var readonly bool
+var device string
+var id string
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "attach NAME",
+		Short: "Attach a disk or a device to a running VM",
+		Long: "Attach a disk or a PCI passthrough device to a running VM.\n\n" +
+			"Attached disks and devices only last until the VM stops, use \"vetu detach\" to detach " +
+			"them earlier and \"vetu inspect\" to list them.",
+		RunE: runAttach,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&disk, "disk", "", "path to the raw disk image to attach")
+	cmd.Flags().BoolVar(&readonly, "readonly", false, "attach the disk in read-only mode")
+	cmd.Flags().StringVar(&device, "device", "", "PCI address of the device to pass through (e.g. "+
+		"--device=0000:01:00.0) or direct device assignment `parameters` in the same format as for "+
+		"\"vetu run --device\" (e.g. --device=\"path=/sys/bus/pci/devices/0000:01:00.0/,iommu=on\")")
+	cmd.Flags().StringVar(&id, "id", "", "ID to assign to the attached disk or device, "+
+		"generated by the Cloud Hypervisor by default")
+	cmd.MarkFlagsMutuallyExclusive("disk", "device")
+	cmd.MarkFlagsOneRequired("disk", "device")
+
+	return cmd
+}
+
+func runAttach(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	localName, err := localname.NewFromString(name)
+	if err != nil {
+		return err
+	}
+
+	if readonly && disk == "" {
+		return fmt.Errorf("%w: --readonly can only be used together with --disk", ErrAttach)
+	}
+
+	var attachment vmdirectory.Attachment
+	var attach func(api *cloudhypervisor.APIClient) (*cloudhypervisor.PCIDeviceInfo, error)
+
+	if disk != "" {
+		diskPath, err := filepath.Abs(disk)
+		if err != nil {
+			return err
+		}
+
+		// The disk image is opened by the Cloud Hypervisor process,
+		// so provide a better error message for the common case
+		if _, err := os.Stat(diskPath); err != nil {
+			return fmt.Errorf("%w: %v", ErrAttach, err)
+		}
+
+		attachment = vmdirectory.Attachment{Kind: vmdirectory.AttachmentKindDisk, Path: diskPath}
+		attach = func(api *cloudhypervisor.APIClient) (*cloudhypervisor.PCIDeviceInfo, error) {
+			return api.AddDisk(cmd.Context(), cloudhypervisor.AddDiskRequest{
+				Path:     diskPath,
+				Readonly: readonly,
+				ID:       id,
+			})
+		}
+	} else {
+		parsedDevice, err := vmconfig.ParseDevice(device)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrAttach, err)
+		}
+
+		if id != "" {
+			parsedDevice.ID = id
+		}
+
+		// Cloud Hypervisor's vm.add-device API only accepts the known options
+		if len(parsedDevice.Options) != 0 {
+			return fmt.Errorf("%w: device options %s cannot be used when attaching to the running VM, "+
+				"use \"vetu set --device\" and restart the VM instead", ErrAttach,
+				strings.Join(parsedDevice.Options, ", "))
+		}
+
+		if bdf, ok := parsedDevice.BDF(); ok {
+			if err := vfio.Validate(bdf); err != nil {
+				return fmt.Errorf("%w: %v", ErrAttach, err)
+			}
+		}
+
+		attachment = vmdirectory.Attachment{Kind: vmdirectory.AttachmentKindDevice, Path: parsedDevice.Path}
+		attach = func(api *cloudhypervisor.APIClient) (*cloudhypervisor.PCIDeviceInfo, error) {
+			return api.AddDevice(cmd.Context(), cloudhypervisor.AddDeviceRequest{
+				Path:       parsedDevice.Path,
+				IOMMU:      parsedDevice.IOMMU,
+				PCISegment: parsedDevice.PCISegment,
+				ID:         parsedDevice.ID,
+			})
+		}
+	}
+
+	// Attach under a global lock to avoid losing the
+	// concurrent changes to the VM's attachments
+	_, err = globallock.With(cmd.Context(), func() (struct{}, error) {
+		vmDir, err := local.Open(localName)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		api, err := vmDir.API()
+		if err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrAttach, err)
+		}
+
+		attachments, err := vmDir.Attachments()
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		deviceInfo, err := attach(api)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrAttach, err)
+		}
+
+		attachment.ID = deviceInfo.ID
+		attachment.BDF = deviceInfo.BDF
+
+		if err := vmDir.SetAttachments(append(attachments, attachment)); err != nil {
+			return struct{}{}, err
+		}
+
+		fmt.Printf("attached %s %s as %s at PCI address %s\n", attachment.Kind, attachment.Path,
+			attachment.ID, attachment.BDF)
+
+		return struct{}{}, nil
+	})
+
+	return err
+}
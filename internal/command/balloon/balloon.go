@@ -0,0 +1,101 @@
+package balloon
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var ErrBalloon = errors.New("failed to resize VM's memory balloon")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "balloon NAME SIZE",
+		Short: "Resize the memory balloon of a running VM",
+		Long: "Resize the memory balloon of a running VM.\n\n" +
+			"Inflating the balloon (e.g. to 2GiB) reclaims the specified amount of memory from the guest " +
+			"and returns it to the host, whereas deflating the balloon (e.g. to 0) gives the memory back " +
+			"to the guest. The VM needs to be configured with a memory balloon device beforehand " +
+			"(see \"vetu set --balloon\").",
+		RunE: runBalloon,
+		Args: cobra.ExactArgs(2),
+	}
+
+	return cmd
+}
+
+func runBalloon(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	balloonSize, err := humanize.ParseBytes(args[1])
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse balloon size %q: %v", ErrBalloon, args[1], err)
+	}
+
+	localName, err := localname.NewFromString(name)
+	if err != nil {
+		return err
+	}
+
+	// Open the VM directory and read its configuration under a global lock
+	vm, err := globallock.With(cmd.Context(),
+		func() (lo.Tuple2[*vmdirectory.VMDirectory, *vmconfig.VMConfig], error) {
+			vmDir, err := local.Open(localName)
+			if err != nil {
+				return lo.Tuple2[*vmdirectory.VMDirectory, *vmconfig.VMConfig]{}, err
+			}
+
+			vmConfig, err := vmDir.Config()
+			if err != nil {
+				return lo.Tuple2[*vmdirectory.VMDirectory, *vmconfig.VMConfig]{}, err
+			}
+
+			return lo.T2(vmDir, vmConfig), nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	vmDir, vmConfig := lo.Unpack2(vm)
+
+	if vmConfig.Balloon == nil {
+		return fmt.Errorf("%w: VM %s has no memory balloon device, add it using \"vetu set --balloon\" "+
+			"and restart the VM", ErrBalloon, name)
+	}
+
+	if vmConfig.MemorySize != 0 && balloonSize > vmConfig.MemorySize {
+		return fmt.Errorf("%w: balloon size of %s exceeds the VM's memory size of %s", ErrBalloon,
+			humanize.IBytes(balloonSize), humanize.IBytes(vmConfig.MemorySize))
+	}
+
+	api, err := vmDir.API()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBalloon, err)
+	}
+
+	if err := api.Resize(cmd.Context(), cloudhypervisor.ResizeRequest{
+		DesiredBalloon: &balloonSize,
+	}); err != nil {
+		return fmt.Errorf("%w: %v", ErrBalloon, err)
+	}
+
+	info, err := api.Info(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBalloon, err)
+	}
+
+	// The guest adjusts the balloon asynchronously
+	fmt.Printf("resizing the memory balloon to %s, the guest currently has %s of memory\n",
+		humanize.IBytes(balloonSize), humanize.IBytes(info.MemoryActualSize))
+
+	return nil
+}
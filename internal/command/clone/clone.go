@@ -11,7 +11,10 @@ import (
 	"github.com/cirruslabs/vetu/internal/storage/remote"
 	"github.com/cirruslabs/vetu/internal/storage/temporary"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/cobra"
+	"path/filepath"
+	"time"
 )
 
 var concurrency uint8
@@ -78,6 +81,12 @@ func runClone(cmd *cobra.Command, args []string) error {
 			return nil, err
 		}
 
+		// Keep the recently cloned VM images in the OCI cache
+		// when evicting the least recently used ones
+		if err := srcVMDir.SetLastAccessed(time.Now()); err != nil {
+			return nil, err
+		}
+
 		return srcVMDir, nil
 	})
 	if err != nil {
@@ -102,6 +111,15 @@ func runClone(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Remember the remote VM image that we've cloned from,
+	// which the OCI cache entry knows best, unless it was
+	// pulled by an older Vetu version
+	if remoteName, ok := srcName.(remotename.RemoteName); ok {
+		if err := setOrigin(tmpVMDir, remoteName); err != nil {
+			return err
+		}
+	}
+
 	_, err = globallock.With[struct{}](cmd.Context(), func() (struct{}, error) {
 		if err := local.MoveIn(dstLocalName, tmpVMDir); err != nil {
 			return struct{}{}, err
@@ -112,3 +130,25 @@ func runClone(cmd *cobra.Command, args []string) error {
 
 	return err
 }
+
+func setOrigin(vmDir *vmdirectory.VMDirectory, remoteName remotename.RemoteName) error {
+	origin, err := vmDir.Origin()
+	if err != nil {
+		return err
+	}
+	if origin == nil {
+		origin = &vmdirectory.Origin{}
+	}
+
+	resolvedPath, err := remote.PathForResolved(remoteName)
+	if err != nil {
+		return err
+	}
+
+	// Use the remote name that the VM was cloned with, since
+	// the VM image might've been pulled with a different tag
+	origin.RemoteName = remoteName.String()
+	origin.Digest = digest.Digest(filepath.Base(resolvedPath))
+
+	return vmDir.SetOrigin(origin)
+}
@@ -0,0 +1,150 @@
+package compact
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/sparseio"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var discard bool
+
+var ErrCompact = errors.New("failed to compact VM's disks")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compact NAME",
+		Short: "Reclaim the space occupied by the zeroed blocks of VM's disks",
+		Long: "Reclaim the space occupied by the zeroed blocks of VM's disks.\n\n" +
+			"Raw disks are scanned for the blocks that only contain zeroes, which are then " +
+			"deallocated by punching holes in the disk files. Zero the free space in the guest " +
+			"to make the deleted files reclaimable.\n\n" +
+			"Cloud Hypervisor also punches holes in the raw disks on guest's discard (TRIM) requests " +
+			"by default, so running fstrim in the guest reclaims the space at run-time, unless " +
+			"the disk's \"sparse\" option is disabled (see --discard).\n\n" +
+			"QCOW2 disks are skipped.",
+		RunE: runCompact,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().BoolVar(&discard, "discard", false, "additionally reset the \"sparse\" option of the VM's "+
+		"raw disks if it was disabled, so that the guest's TRIM requests deallocate the disk file blocks "+
+		"at run-time")
+
+	return cmd
+}
+
+func runCompact(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	localName, err := localname.NewFromString(name)
+	if err != nil {
+		return err
+	}
+
+	// Open and lock VM directory (under a global lock) until the end of the "vetu compact" execution
+	vmDir, err := globallock.With(cmd.Context(), func() (*vmdirectory.VMDirectory, error) {
+		vmDir, err := local.Open(localName)
+		if err != nil {
+			return nil, err
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockExclusive)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lock.Trylock(); err != nil {
+			if errors.Is(err, filelock.ErrAlreadyLocked) && vmDir.Running() {
+				return nil, fmt.Errorf("%w: VM %s is running, please stop it first", ErrCompact, name)
+			}
+
+			return nil, err
+		}
+
+		return vmDir, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+
+	table := uitable.New()
+
+	table.AddRow("Disk", "Before", "After", "Reclaimed")
+
+	var totalReclaimed uint64
+	var sparseReset bool
+
+	for i, disk := range vmConfig.Disks {
+		if disk.ImageType == vmconfig.ImageTypeQCOW2 {
+			continue
+		}
+
+		before, after, err := compactDisk(vmDir, disk.Name)
+		if err != nil {
+			return err
+		}
+
+		reclaimed := before - min(after, before)
+		totalReclaimed += reclaimed
+
+		table.AddRow(disk.Name, humanize.Bytes(before), humanize.Bytes(after), humanize.Bytes(reclaimed))
+
+		if discard && disk.Sparse != nil && !*disk.Sparse {
+			vmConfig.Disks[i].Sparse = nil
+			sparseReset = true
+		}
+	}
+
+	if sparseReset {
+		if err := vmDir.SetConfig(vmConfig); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(table.String())
+	fmt.Printf("reclaimed %s in total\n", humanize.Bytes(totalReclaimed))
+
+	return nil
+}
+
+// compactDisk compacts the VM's disk and returns
+// its allocated size before and after the compaction.
+func compactDisk(vmDir *vmdirectory.VMDirectory, diskName string) (uint64, uint64, error) {
+	_, before, err := vmDir.FileSize(diskName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to retrieve the size of disk %q: %v", ErrCompact, diskName, err)
+	}
+
+	diskFile, err := os.OpenFile(filepath.Join(vmDir.Path(), diskName), os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to open disk %q: %v", ErrCompact, diskName, err)
+	}
+	defer diskFile.Close()
+
+	if err := sparseio.Compact(diskFile); err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to compact disk %q: %v", ErrCompact, diskName, err)
+	}
+
+	_, after, err := vmDir.FileSize(diskName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to retrieve the size of disk %q: %v", ErrCompact, diskName, err)
+	}
+
+	return before, after, nil
+}
@@ -17,7 +17,7 @@ var kernel string
 var initramfs string
 var cmdline string
 var disks []string
-var cpu uint8
+var cpu uint16
 var memory uint16
 
 func NewCommand() *cobra.Command {
@@ -36,7 +36,7 @@ func NewCommand() *cobra.Command {
 		"when booting the new VM")
 	cmd.Flags().StringArrayVar(&disks, "disk", []string{}, "path to a disk file to use "+
 		"when booting the new VM (can be specified multiple times, will be copied to the VM's directory)")
-	cmd.Flags().Uint8Var(&cpu, "cpu", 2, "number of VM CPUs to use "+
+	cmd.Flags().Uint16Var(&cpu, "cpu", 2, "number of VM CPUs to use "+
 		"for the new VM")
 	cmd.Flags().Uint16Var(&memory, "memory", 4096, "amount of memory to use "+
 		"for the new VM in MiB (mebibytes)")
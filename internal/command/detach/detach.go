@@ -0,0 +1,70 @@
+package detach
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var ErrDetach = errors.New("failed to detach from the VM")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "detach NAME ID",
+		Short: "Detach a disk or a device from a running VM",
+		Long: "Detach a disk or a PCI passthrough device from a running VM by its ID, " +
+			"which is printed by \"vetu attach\" and listed by \"vetu inspect\".\n\n" +
+			"Devices passed to \"vetu run --device\" can be detached too, as long as their ID is known.",
+		RunE: runDetach,
+		Args: cobra.ExactArgs(2),
+	}
+
+	return cmd
+}
+
+func runDetach(cmd *cobra.Command, args []string) error {
+	name, id := args[0], args[1]
+
+	localName, err := localname.NewFromString(name)
+	if err != nil {
+		return err
+	}
+
+	// Detach under a global lock to avoid losing the
+	// concurrent changes to the VM's attachments
+	_, err = globallock.With(cmd.Context(), func() (struct{}, error) {
+		vmDir, err := local.Open(localName)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		api, err := vmDir.API()
+		if err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrDetach, err)
+		}
+
+		attachments, err := vmDir.Attachments()
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		if err := api.RemoveDevice(cmd.Context(), cloudhypervisor.RemoveDeviceRequest{ID: id}); err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrDetach, err)
+		}
+
+		attachments = lo.Reject(attachments, func(attachment vmdirectory.Attachment, _ int) bool {
+			return attachment.ID == id
+		})
+
+		return struct{}{}, vmDir.SetAttachments(attachments)
+	})
+
+	return err
+}
@@ -0,0 +1,55 @@
+package device
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cirruslabs/vetu/internal/vfio"
+	"github.com/spf13/cobra"
+)
+
+func newBindCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bind BDF",
+		Short: "Bind host's PCI device to the vfio-pci driver",
+		Long: "Bind host's PCI device (e.g. 0000:01:00.0, see \"lspci -D\") to the vfio-pci driver, " +
+			"which is required to pass it through to the VM using \"vetu set --device\" or " +
+			"\"vetu run --device\".\n\n" +
+			"The device is unbound from its current driver first, so make sure that the host doesn't " +
+			"use it anymore. Note that the binding doesn't persist across host reboots and requires " +
+			"the root privileges.",
+		RunE: runBind,
+		Args: cobra.ExactArgs(1),
+	}
+
+	return cmd
+}
+
+func runBind(cmd *cobra.Command, args []string) error {
+	bdf, err := vfio.ParseBDF(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDevice, err)
+	}
+
+	previousDriver, err := vfio.Bind(bdf)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDevice, err)
+	}
+
+	switch previousDriver {
+	case vfio.Driver:
+		fmt.Printf("device %s is already bound to the %s driver\n", bdf, vfio.Driver)
+	case "":
+		fmt.Printf("bound device %s to the %s driver\n", bdf, vfio.Driver)
+	default:
+		fmt.Printf("rebound device %s from the %s driver to the %s driver\n", bdf, previousDriver, vfio.Driver)
+	}
+
+	// Binding the device itself is not enough when
+	// other devices in its IOMMU group are still in use
+	if err := vfio.Validate(bdf); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "device %s cannot be passed through yet: %v\n", bdf, err)
+	}
+
+	return nil
+}
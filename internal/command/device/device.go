@@ -0,0 +1,22 @@
+package device
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrDevice = errors.New("failed to manage the host's device")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "device",
+		Short: "Manage host's devices for the direct device assignment",
+	}
+
+	cmd.AddCommand(
+		newBindCommand(),
+	)
+
+	return cmd
+}
@@ -0,0 +1,136 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/name/simplename"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	cp "github.com/otiai10/copy"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var addSize string
+var addFrom string
+
+func newAddCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add NAME [DISK]",
+		Short: "Add a disk to the VM",
+		Long: "Add a new sparse raw disk of the specified size (--size) or a copy " +
+			"of an existing disk file (--from) to the VM.\n\n" +
+			"When DISK is not specified, the disk will be named after the --from file, " +
+			"or as \"diskN.img\" for the new disks.",
+		RunE: runAdd,
+		Args: cobra.RangeArgs(1, 2),
+	}
+
+	cmd.Flags().StringVar(&addSize, "size", "", "size of the new disk (e.g. 20G or 20GiB)")
+	cmd.Flags().StringVar(&addFrom, "from", "", "path to a disk file to add to the VM "+
+		"(will be copied to the VM's directory)")
+	cmd.MarkFlagsMutuallyExclusive("size", "from")
+	cmd.MarkFlagsOneRequired("size", "from")
+
+	return cmd
+}
+
+func runAdd(cmd *cobra.Command, args []string) error {
+	var sizeBytes int64
+
+	if addSize != "" {
+		var err error
+
+		sizeBytes, err = parseSize(addSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	vmDir, err := openStopped(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+
+	var diskName string
+
+	switch {
+	case len(args) > 1:
+		diskName = args[1]
+	case addFrom != "":
+		diskName = filepath.Base(addFrom)
+	default:
+		diskName = nextDiskName(vmDir.Path())
+	}
+
+	if err := simplename.Validate(diskName); err != nil {
+		return fmt.Errorf("%w: disk name %q %v", ErrDisk, diskName, err)
+	}
+
+	if vmdirectory.IsReservedName(diskName) {
+		return fmt.Errorf("%w: disk name %q is reserved for the VM's own files", ErrDisk, diskName)
+	}
+
+	diskPath := filepath.Join(vmDir.Path(), diskName)
+
+	if _, err := os.Lstat(diskPath); err == nil {
+		return fmt.Errorf("%w: file %q already exists in the VM's directory", ErrDisk, diskName)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if addFrom != "" {
+		if err := cp.Copy(addFrom, diskPath); err != nil {
+			return fmt.Errorf("%w: failed to copy disk %q to the VM's directory: %v", ErrDisk, diskName, err)
+		}
+	} else {
+		if err := createSparse(diskPath, sizeBytes); err != nil {
+			return fmt.Errorf("%w: failed to create disk %q: %v", ErrDisk, diskName, err)
+		}
+	}
+
+	vmConfig.Disks = append(vmConfig.Disks, vmconfig.Disk{
+		Name: diskName,
+	})
+
+	if err := vmDir.SetConfig(vmConfig); err != nil {
+		_ = os.Remove(diskPath)
+
+		return err
+	}
+
+	return nil
+}
+
+func createSparse(path string, sizeBytes int64) error {
+	diskFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := diskFile.Truncate(sizeBytes); err != nil {
+		_ = diskFile.Close()
+		_ = os.Remove(path)
+
+		return err
+	}
+
+	return diskFile.Close()
+}
+
+// nextDiskName returns the first "diskN.img" name that is not taken yet.
+func nextDiskName(vmDirPath string) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("disk%d.img", i)
+
+		if _, err := os.Lstat(filepath.Join(vmDirPath, name)); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+	}
+}
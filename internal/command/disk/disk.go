@@ -0,0 +1,89 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var ErrDisk = errors.New("failed to modify VM's disks")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disk",
+		Short: "Manage VM's disks",
+	}
+
+	cmd.AddCommand(
+		newAddCommand(),
+		newRmCommand(),
+		newResizeCommand(),
+		newShrinkCommand(),
+	)
+
+	return cmd
+}
+
+// openStopped opens and locks the local VM's directory (under a global lock)
+// until the end of the command execution, making sure that the VM is not running.
+func openStopped(ctx context.Context, name string) (*vmdirectory.VMDirectory, error) {
+	localName, err := localname.NewFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return globallock.With(ctx, func() (*vmdirectory.VMDirectory, error) {
+		vmDir, err := local.Open(localName)
+		if err != nil {
+			return nil, err
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockExclusive)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lock.Trylock(); err != nil {
+			if errors.Is(err, filelock.ErrAlreadyLocked) && vmDir.Running() {
+				return nil, fmt.Errorf("%w: VM %s is running, please stop it first", ErrDisk, name)
+			}
+
+			return nil, err
+		}
+
+		return vmDir, nil
+	})
+}
+
+func findDisk(vmConfig *vmconfig.VMConfig, diskName string) (int, error) {
+	_, index, ok := lo.FindIndexOf(vmConfig.Disks, func(disk vmconfig.Disk) bool {
+		return disk.Name == diskName
+	})
+	if !ok {
+		return 0, fmt.Errorf("%w: VM has no disk named %q", ErrDisk, diskName)
+	}
+
+	return index, nil
+}
+
+func parseSize(size string) (int64, error) {
+	sizeBytes, err := humanize.ParseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse disk size %q: %v", ErrDisk, size, err)
+	}
+
+	if sizeBytes == 0 {
+		return 0, fmt.Errorf("%w: disk size cannot be zero", ErrDisk)
+	}
+
+	return int64(sizeBytes), nil
+}
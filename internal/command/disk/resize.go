@@ -0,0 +1,77 @@
+package disk
+
+import (
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+func newResizeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resize NAME DISK SIZE",
+		Short: "Resize VM's disk",
+		Long: "Resize VM's disk to the specified size (e.g. 50G or 50GiB).\n\n" +
+			"Note that the disk size can only be increased to avoid losing data, " +
+			"and that the partitions and the file systems on the disk need to be " +
+			"grown separately (e.g. by the guest's cloud-init on the next boot).",
+		RunE: runResize,
+		Args: cobra.ExactArgs(3),
+	}
+
+	return cmd
+}
+
+func runResize(cmd *cobra.Command, args []string) error {
+	diskName := args[1]
+
+	desiredSizeBytes, err := parseSize(args[2])
+	if err != nil {
+		return err
+	}
+
+	vmDir, err := openStopped(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+
+	index, err := findDisk(vmConfig, diskName)
+	if err != nil {
+		return err
+	}
+
+	// Truncating doesn't change the virtual size of a QCOW2 image and may corrupt it
+	if vmConfig.Disks[index].ImageType == vmconfig.ImageTypeQCOW2 {
+		return fmt.Errorf("%w: disk %q is a QCOW2 image, only raw disks can be resized", ErrDisk, diskName)
+	}
+
+	diskFile, err := os.OpenFile(filepath.Join(vmDir.Path(), diskName), os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("%w: failed to open disk %q: %v", ErrDisk, diskName, err)
+	}
+	defer diskFile.Close()
+
+	diskStat, err := diskFile.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: failed to retrieve the size of disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	if actualSizeBytes := diskStat.Size(); desiredSizeBytes < actualSizeBytes {
+		return fmt.Errorf("%w: new disk size of %s should be larger than the current disk size of %s "+
+			"(use \"vetu disk shrink\" to shrink the disk to fit its partitions)",
+			ErrDisk, humanize.Bytes(uint64(desiredSizeBytes)), humanize.Bytes(uint64(actualSizeBytes)))
+	}
+
+	if err := diskFile.Truncate(desiredSizeBytes); err != nil {
+		return fmt.Errorf("%w: failed to truncate disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	return diskFile.Close()
+}
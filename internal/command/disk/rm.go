@@ -0,0 +1,53 @@
+package disk
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+func newRmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm NAME DISK",
+		Short: "Remove a disk from the VM",
+		RunE:  runRm,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	return cmd
+}
+
+func runRm(cmd *cobra.Command, args []string) error {
+	diskName := args[1]
+
+	vmDir, err := openStopped(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+
+	index, err := findDisk(vmConfig, diskName)
+	if err != nil {
+		return err
+	}
+
+	vmConfig.Disks = slices.Delete(vmConfig.Disks, index, index+1)
+
+	// Update the configuration first to avoid
+	// leaving a VM that references a missing disk
+	if err := vmDir.SetConfig(vmConfig); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(vmDir.Path(), diskName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w: failed to remove disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	return nil
+}
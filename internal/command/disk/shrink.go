@@ -0,0 +1,127 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/gpt"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+// shrinkAlignment is the alignment of the shrunk disk size,
+// which is also the granularity used by most partitioning tools
+const shrinkAlignment = 1024 * 1024
+
+var slack string
+
+func newShrinkCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shrink NAME [DISK]",
+		Short: "Shrink VM's disk to fit its partitions",
+		Long: "Shrink VM's disk (the first disk by default) to fit its partitions.\n\n" +
+			"The disk's GPT partition table is used to find the end of the last partition, " +
+			"after which the disk is truncated and the backup GPT is relocated to the new " +
+			"end of the disk. Note that the partitions and the file systems on the disk " +
+			"are not shrunk, so shrink them in the guest first to reclaim more space.",
+		RunE: runShrink,
+		Args: cobra.RangeArgs(1, 2),
+	}
+
+	cmd.Flags().StringVar(&slack, "slack", "0", "additional space to leave after the last "+
+		"partition (e.g. 100MiB), the resulting disk size is always aligned to 1 MiB")
+
+	return cmd
+}
+
+func runShrink(cmd *cobra.Command, args []string) error {
+	slackBytes, err := humanize.ParseBytes(slack)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse slack size %q: %v", ErrDisk, slack, err)
+	}
+
+	vmDir, err := openStopped(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+
+	if len(vmConfig.Disks) == 0 {
+		return fmt.Errorf("%w: VM has no disks", ErrDisk)
+	}
+
+	diskName := vmConfig.Disks[0].Name
+
+	if len(args) == 2 {
+		diskName = args[1]
+	}
+
+	index, err := findDisk(vmConfig, diskName)
+	if err != nil {
+		return err
+	}
+
+	if vmConfig.Disks[index].ImageType == vmconfig.ImageTypeQCOW2 {
+		return fmt.Errorf("%w: disk %q is a QCOW2 image, only raw disks can be shrunk", ErrDisk, diskName)
+	}
+
+	diskFile, err := os.OpenFile(filepath.Join(vmDir.Path(), diskName), os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("%w: failed to open disk %q: %v", ErrDisk, diskName, err)
+	}
+	defer diskFile.Close()
+
+	diskStat, err := diskFile.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: failed to retrieve the size of disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	table, err := gpt.Read(diskFile)
+	if err != nil {
+		if errors.Is(err, gpt.ErrNotFound) {
+			return fmt.Errorf("%w: disk %q has no GPT partition table, only GPT-partitioned disks "+
+				"can be shrunk safely", ErrDisk, diskName)
+		}
+
+		return fmt.Errorf("%w: failed to read the partition table of disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	actualSizeBytes := diskStat.Size()
+	minimumSizeBytes := table.MinimumSize()
+	desiredSizeBytes := alignUp(minimumSizeBytes+int64(slackBytes), shrinkAlignment)
+
+	if desiredSizeBytes >= actualSizeBytes {
+		return fmt.Errorf("%w: disk %q cannot be shrunk: its partitions occupy %s of %s, "+
+			"shrink the last partition and its file system in the guest first",
+			ErrDisk, diskName, humanize.Bytes(uint64(minimumSizeBytes)), humanize.Bytes(uint64(actualSizeBytes)))
+	}
+
+	// Relocate the backup GPT before truncating the disk, so that
+	// the disk is never left without a valid partition table
+	if err := table.Resize(diskFile, desiredSizeBytes); err != nil {
+		return fmt.Errorf("%w: failed to update the partition table of disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	if err := diskFile.Sync(); err != nil {
+		return fmt.Errorf("%w: failed to update the partition table of disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	if err := diskFile.Truncate(desiredSizeBytes); err != nil {
+		return fmt.Errorf("%w: failed to truncate disk %q: %v", ErrDisk, diskName, err)
+	}
+
+	fmt.Printf("shrunk disk %s from %s to %s\n", diskName,
+		humanize.Bytes(uint64(actualSizeBytes)), humanize.Bytes(uint64(desiredSizeBytes)))
+
+	return diskFile.Close()
+}
+
+func alignUp(value int64, alignment int64) int64 {
+	return (value + alignment - 1) / alignment * alignment
+}
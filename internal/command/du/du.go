@@ -0,0 +1,123 @@
+package du
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cirruslabs/vetu/internal/diskusage"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/outputformat"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/gosuri/uitable"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+type Storage struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	diskusage.Usage
+}
+
+var format string
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "du",
+		Short: "Summarize disk usage of the local and OCI storage",
+		Long: "Summarize disk usage of the local and OCI storage.\n\n" +
+			"Apparent size is the sum of the VM files sizes, whereas allocated size is the space " +
+			"actually occupied on disk, which is smaller for sparse disks. Extents shared between " +
+			"the VMs (e.g. when cloning on a file system with reflink support) are only counted once.",
+		RunE: runDU,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.Flags().StringVar(&format, "format", outputformat.Text, outputformat.Usage)
+
+	return cmd
+}
+
+func runDU(cmd *cobra.Command, args []string) error {
+	outputFormat, err := outputformat.Parse(format)
+	if err != nil {
+		return err
+	}
+
+	// Calculate disk usage under a global lock
+	storages, err := globallock.With(cmd.Context(), func() ([]Storage, error) {
+		localVMs, err := local.List()
+		if err != nil {
+			return nil, err
+		}
+
+		localVMDirs := lo.Map(localVMs,
+			func(item lo.Tuple2[string, *vmdirectory.VMDirectory], _ int) *vmdirectory.VMDirectory {
+				return item.B
+			},
+		)
+
+		remoteVMDirs, err := remote.VMDirs()
+		if err != nil {
+			return nil, err
+		}
+
+		totalCounter := diskusage.New()
+
+		var result []Storage
+
+		for _, storage := range []lo.Tuple2[string, []*vmdirectory.VMDirectory]{
+			lo.T2("local", localVMDirs),
+			lo.T2("oci", remoteVMDirs),
+		} {
+			name, vmDirs := lo.Unpack2(storage)
+
+			counter := diskusage.New()
+
+			for _, vmDir := range vmDirs {
+				if err := counter.AddDir(vmDir.Path()); err != nil {
+					return nil, err
+				}
+
+				if err := totalCounter.AddDir(vmDir.Path()); err != nil {
+					return nil, err
+				}
+			}
+
+			result = append(result, Storage{
+				Name:  name,
+				Count: len(vmDirs),
+				Usage: counter.Usage(),
+			})
+		}
+
+		return append(result, Storage{
+			Name:  "total",
+			Count: len(localVMDirs) + len(remoteVMDirs),
+			Usage: totalCounter.Usage(),
+		}), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !outputFormat.IsText() {
+		return outputformat.PrintList(os.Stdout, outputFormat, storages)
+	}
+
+	table := uitable.New()
+
+	table.AddRow("Storage", "VMs", "Apparent size", "Allocated size", "Shared size")
+
+	for _, storage := range storages {
+		table.AddRow(storage.Name, storage.Count, humanize.Bytes(storage.Apparent),
+			humanize.Bytes(storage.Allocated), humanize.Bytes(storage.Shared))
+	}
+
+	fmt.Println(table.String())
+
+	return nil
+}
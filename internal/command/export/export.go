@@ -0,0 +1,114 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/oci"
+	"github.com/cirruslabs/vetu/internal/ociarchive"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export NAME FILE",
+		Short: "Export a VM to an OCI image-layout archive",
+		Long: "Export a VM to a tar archive in the OCI image-layout format that can be later imported " +
+			"with \"vetu import\" on another host. The archive will be compressed with zstd " +
+			"if the FILE ends with \".zst\" (e.g. \"ubuntu.tar.zst\").",
+		RunE: runExport,
+		Args: cobra.ExactArgs(2),
+	}
+
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	srcName, err := name.NewFromString(args[0])
+	if err != nil {
+		return err
+	}
+
+	archivePath := args[1]
+
+	// Open and lock VM directory (under a global lock) until the end of the "vetu export" execution
+	vmDir, err := globallock.With(cmd.Context(), func() (*vmdirectory.VMDirectory, error) {
+		var vmDir *vmdirectory.VMDirectory
+
+		switch typedSrcName := srcName.(type) {
+		case localname.LocalName:
+			vmDir, err = local.Open(typedSrcName)
+		case remotename.RemoteName:
+			vmDir, err = remote.Open(typedSrcName)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockShared)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lock.Trylock(); err != nil {
+			return nil, err
+		}
+
+		return vmDir, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Create a temporary directory to hold the OCI image layout
+	layoutDir, layoutLock, err := temporary.CreateDirTryLocked()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(layoutDir)
+		_ = layoutLock.Unlock()
+	}()
+
+	// Push the VM to the OCI image layout
+	reference, err := ref.New(fmt.Sprintf("ocidir://%s:latest", layoutDir))
+	if err != nil {
+		return err
+	}
+
+	client := regclient.New()
+
+	if _, err := oci.PushVMDirectory(cmd.Context(), client, vmDir, reference, oci.PushOptions{}); err != nil {
+		return err
+	}
+
+	// Archive the OCI image layout
+	fmt.Printf("writing %s...\n", archivePath)
+
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if err := ociarchive.Create(archiveFile, layoutDir, ociarchive.IsCompressedName(
+		filepath.Base(archivePath))); err != nil {
+		_ = archiveFile.Close()
+		_ = os.Remove(archivePath)
+
+		return err
+	}
+
+	return archiveFile.Close()
+}
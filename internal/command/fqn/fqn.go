@@ -5,12 +5,21 @@ import (
 	"github.com/cirruslabs/vetu/internal/name"
 	"github.com/cirruslabs/vetu/internal/name/localname"
 	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/outputformat"
 	"github.com/cirruslabs/vetu/internal/storage/remote"
 	"github.com/opencontainers/go-digest"
 	"github.com/spf13/cobra"
+	"os"
 	"path/filepath"
 )
 
+type Info struct {
+	Name string `json:"name"`
+	FQN  string `json:"fqn"`
+}
+
+var format string
+
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:    "fqn",
@@ -20,29 +29,54 @@ func NewCommand() *cobra.Command {
 		Hidden: true,
 	}
 
+	cmd.Flags().StringVar(&format, "format", outputformat.Text, outputformat.Usage)
+
 	return cmd
 }
 
 func runFQN(cmd *cobra.Command, args []string) error {
+	outputFormat, err := outputformat.Parse(format)
+	if err != nil {
+		return err
+	}
+
 	name, err := name.NewFromString(args[0])
 	if err != nil {
 		return err
 	}
 
+	fqn, err := resolve(name)
+	if err != nil {
+		return err
+	}
+
+	if outputFormat.IsText() {
+		fmt.Println(fqn)
+
+		return nil
+	}
+
+	return outputFormat.Print(os.Stdout, &Info{
+		Name: args[0],
+		FQN:  fqn,
+	})
+}
+
+func resolve(name name.Name) (string, error) {
 	switch typedSrcName := name.(type) {
 	case localname.LocalName:
-		fmt.Println(typedSrcName.String())
+		return typedSrcName.String(), nil
 	case remotename.RemoteName:
 		resolvedPath, err := remote.PathForResolved(typedSrcName)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		typedSrcName.Tag = ""
 		typedSrcName.Digest = digest.Digest(filepath.Base(resolvedPath))
 
-		fmt.Println(typedSrcName.String())
+		return typedSrcName.String(), nil
 	}
 
-	return nil
+	return "", fmt.Errorf("unsupported name %v", name)
 }
@@ -0,0 +1,147 @@
+// Package importpkg implements the "vetu import" command
+// ("import" is a keyword and cannot be used as a package name).
+package importpkg
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/oci"
+	"github.com/cirruslabs/vetu/internal/ociarchive"
+	"github.com/cirruslabs/vetu/internal/randommac"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+var concurrency uint8
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import FILE NAME",
+		Short: "Import a VM from an OCI image-layout archive",
+		Long: "Import a VM from a tar archive (optionally compressed with zstd) or a directory " +
+			"in the OCI image-layout format, for example, one created with \"vetu export\".",
+		RunE: runImport,
+		Args: cobra.ExactArgs(2),
+	}
+
+	cmd.Flags().Uint8Var(&concurrency, "concurrency", 4,
+		"concurrency to use when unpacking the VM's disks")
+
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	archivePath := args[0]
+
+	dstLocalName, err := localname.NewFromString(args[1])
+	if err != nil {
+		return err
+	}
+
+	// Figure out the OCI image layout location, extracting the archive if needed
+	layoutDir := archivePath
+
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if !archiveInfo.IsDir() {
+		var layoutLock *filelock.FileLock
+
+		layoutDir, layoutLock, err = extractToTemporary(archivePath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(layoutDir)
+			_ = layoutLock.Unlock()
+		}()
+	}
+
+	// Initialize a temporary directory to which we'll first pull the VM image
+	vmDir, lock, err := temporary.CreateTryLocked()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	// Pull the VM from the OCI image layout
+	reference, err := ref.New(fmt.Sprintf("ocidir://%s:latest", layoutDir))
+	if err != nil {
+		return err
+	}
+
+	client := regclient.New()
+
+	manifest, _, err := oci.ResolveManifest(cmd.Context(), client, reference)
+	if err != nil {
+		return err
+	}
+
+	// Disk layers of the VM images that are already in the OCI cache
+	// can be copied locally instead of reading them from the archive
+	localVMDirs, err := remote.VMDirs()
+	if err != nil {
+		return err
+	}
+
+	if err := oci.PullVMDirectory(cmd.Context(), client, reference, manifest, vmDir, int(concurrency),
+		localVMDirs); err != nil {
+		return err
+	}
+
+	// Generate and set a random MAC-address
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return err
+	}
+	vmConfig.MACAddress.HardwareAddr, err = randommac.UnicastAndLocallyAdministered()
+	if err != nil {
+		return err
+	}
+	if err := vmDir.SetConfig(vmConfig); err != nil {
+		return err
+	}
+
+	// Move-in the imported VM under a global lock
+	_, err = globallock.With(cmd.Context(), func() (struct{}, error) {
+		return struct{}{}, local.MoveIn(dstLocalName, vmDir)
+	})
+
+	return err
+}
+
+func extractToTemporary(archivePath string) (string, *filelock.FileLock, error) {
+	layoutDir, layoutLock, err := temporary.CreateDirTryLocked()
+	if err != nil {
+		return "", nil, err
+	}
+
+	fmt.Printf("extracting %s...\n", archivePath)
+
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer archiveFile.Close()
+
+	if err := ociarchive.Extract(archiveFile, layoutDir); err != nil {
+		_ = os.RemoveAll(layoutDir)
+		_ = layoutLock.Unlock()
+
+		return "", nil, err
+	}
+
+	return layoutDir, layoutLock, nil
+}
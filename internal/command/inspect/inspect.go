@@ -0,0 +1,464 @@
+package inspect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cirruslabs/vetu/internal/dockerhosts"
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/oci"
+	"github.com/cirruslabs/vetu/internal/oci/mediatypes"
+	"github.com/cirruslabs/vetu/internal/oci/pull/pullhelper"
+	"github.com/cirruslabs/vetu/internal/oci/pull/tart/tartconfig"
+	"github.com/cirruslabs/vetu/internal/outputformat"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/gosuri/uitable"
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	manifestpkg "github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+type Info struct {
+	Name        string                   `json:"name"`
+	Source      string                   `json:"source"`
+	Reference   string                   `json:"reference,omitempty"`
+	Origin      *vmdirectory.Origin      `json:"origin,omitempty"`
+	State       vmdirectory.State        `json:"state,omitempty"`
+	Config      *vmconfig.VMConfig       `json:"config,omitempty"`
+	TartConfig  *tartconfig.TartConfig   `json:"tartConfig,omitempty"`
+	Disks       []Disk                   `json:"disks,omitempty"`
+	Attachments []vmdirectory.Attachment `json:"attachments,omitempty"`
+	Manifest    *Manifest                `json:"manifest,omitempty"`
+}
+
+type Disk struct {
+	Name          string `json:"name"`
+	ApparentSize  uint64 `json:"apparentSize"`
+	AllocatedSize uint64 `json:"allocatedSize"`
+}
+
+type Manifest struct {
+	Digest string  `json:"digest"`
+	Layers []Layer `json:"layers"`
+}
+
+type Layer struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+var format string
+var remoteOnly bool
+var insecure bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect NAME",
+		Short: "Display detailed information about a VM",
+		Long: "Display detailed information about a local VM, a VM from the OCI cache or a remote VM. " +
+			"Remote VMs that are not in the OCI cache are inspected by only retrieving their manifest " +
+			"and configuration, without pulling the disks.",
+		RunE: runInspect,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&format, "format", outputformat.Text, outputformat.Usage)
+	cmd.Flags().BoolVar(&remoteOnly, "remote", false,
+		"always inspect the remote VM in the registry, even if it's available in the OCI cache")
+	cmd.Flags().BoolVar(&insecure, "insecure", false,
+		"connect to the OCI registry via insecure HTTP protocol")
+
+	return cmd
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	outputFormat, err := outputformat.Parse(format)
+	if err != nil {
+		return err
+	}
+
+	vmName, err := name.NewFromString(args[0])
+	if err != nil {
+		return err
+	}
+
+	var info *Info
+
+	switch typedName := vmName.(type) {
+	case localname.LocalName:
+		info, err = inspectLocal(cmd, "local", typedName.String(), func() (*vmdirectory.VMDirectory, error) {
+			return local.Open(typedName)
+		})
+	case remotename.RemoteName:
+		if !remoteOnly && remote.Exists(typedName) {
+			info, err = inspectLocal(cmd, "oci", typedName.String(), func() (*vmdirectory.VMDirectory, error) {
+				return remote.Open(typedName)
+			})
+		} else {
+			info, err = inspectRemote(cmd, typedName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if !outputFormat.IsText() {
+		return outputFormat.Print(os.Stdout, info)
+	}
+
+	printText(info)
+
+	return nil
+}
+
+func inspectLocal(
+	cmd *cobra.Command,
+	source string,
+	vmName string,
+	open func() (*vmdirectory.VMDirectory, error),
+) (*Info, error) {
+	// Open and lock VM directory (under a global lock) until the end of the "vetu inspect" execution
+	vmDir, err := globallock.With(cmd.Context(), func() (*vmdirectory.VMDirectory, error) {
+		vmDir, err := open()
+		if err != nil {
+			return nil, err
+		}
+
+		// Running VM's directory is exclusively locked by "vetu run",
+		// but it's still safe to read from it, just like "vetu list" does
+		if vmDir.Running() {
+			return vmDir, nil
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockShared)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lock.Trylock(); err != nil {
+			return nil, err
+		}
+
+		return vmDir, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Name:   vmName,
+		Source: source,
+		State:  vmDir.State(),
+		Config: vmConfig,
+	}
+
+	origin, err := vmDir.Origin()
+	if err != nil {
+		return nil, err
+	}
+
+	if origin != nil {
+		info.Origin = origin
+	}
+
+	// VMs in the OCI cache always know where they came from,
+	// even if they were pulled by an older Vetu version
+	if source == "oci" {
+		fqnName, err := remotename.NewFromString(vmName)
+		if err != nil {
+			return nil, err
+		}
+
+		resolvedPath, err := remote.PathForResolved(fqnName)
+		if err != nil {
+			return nil, err
+		}
+
+		fqnName.Tag = ""
+		fqnName.Digest = digest.Digest(filepath.Base(resolvedPath))
+
+		info.Reference = fqnName.String()
+	} else if origin != nil {
+		originName, err := remotename.NewFromString(origin.RemoteName)
+		if err != nil {
+			return nil, err
+		}
+
+		originName.Tag = ""
+		originName.Digest = origin.Digest
+
+		info.Reference = originName.String()
+	}
+
+	for _, disk := range vmConfig.Disks {
+		apparentSize, allocatedSize, err := vmDir.FileSize(disk.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Disks = append(info.Disks, Disk{
+			Name:          disk.Name,
+			ApparentSize:  apparentSize,
+			AllocatedSize: allocatedSize,
+		})
+	}
+
+	if info.State == vmdirectory.StateRunning {
+		info.Attachments, err = vmDir.Attachments()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func inspectRemote(cmd *cobra.Command, remoteName remotename.RemoteName) (*Info, error) {
+	// Convert remoteName to ref.Ref that is used in github.com/regclient/regclient
+	reference, err := ref.New(remoteName.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// Load hosts from the Docker configuration file
+	hosts, err := dockerhosts.Load(reference, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize OCI registry client
+	client := regclient.New(regclient.WithConfigHost(hosts...))
+
+	manifest, resolvedDigest, err := oci.ResolveManifest(cmd.Context(), client, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	fqnName := remoteName
+	fqnName.Tag = ""
+	fqnName.Digest = resolvedDigest
+
+	info := &Info{
+		Name:      remoteName.String(),
+		Source:    "remote",
+		Reference: fqnName.String(),
+		Manifest: &Manifest{
+			Digest: manifest.GetDescriptor().Digest.String(),
+		},
+	}
+
+	layers, err := manifest.(manifestpkg.Imager).GetLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range layers {
+		info.Manifest.Layers = append(info.Manifest.Layers, Layer{
+			MediaType:   layer.MediaType,
+			Digest:      layer.Digest.String(),
+			Size:        layer.Size,
+			Annotations: layer.Annotations,
+		})
+
+		// Only pull the VM's config, but not the kernel or the disks
+		switch layer.MediaType {
+		case mediatypes.MediaTypeConfig:
+			vmConfigBytes, err := pullhelper.PullBlob(cmd.Context(), client, reference, layer)
+			if err != nil {
+				return nil, err
+			}
+
+			info.Config, err = vmconfig.NewFromJSON(vmConfigBytes)
+			if err != nil {
+				return nil, err
+			}
+		case mediatypes.MediaTypeTartConfig:
+			tartConfigBytes, err := pullhelper.PullBlob(cmd.Context(), client, reference, layer)
+			if err != nil {
+				return nil, err
+			}
+
+			info.TartConfig, err = tartconfig.NewFromJSON(tartConfigBytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func printText(info *Info) {
+	table := uitable.New()
+	table.Wrap = true
+
+	table.AddRow("Name:", info.Name)
+	table.AddRow("Source:", info.Source)
+
+	if info.Reference != "" {
+		table.AddRow("Reference:", info.Reference)
+	}
+	if info.Origin != nil {
+		table.AddRow("Origin:", info.Origin.RemoteName)
+
+		if !info.Origin.PullTime.IsZero() {
+			table.AddRow("Pulled:", fmt.Sprintf("%s (%s)", info.Origin.PullTime.Format(time.RFC3339),
+				humanize.Time(info.Origin.PullTime)))
+		}
+		if info.Origin.VetuVersion != "" {
+			table.AddRow("Pulled by:", "Vetu "+info.Origin.VetuVersion)
+		}
+	}
+	if info.State != "" {
+		table.AddRow("State:", info.State)
+	}
+
+	if info.Config != nil {
+		table.AddRow("Architecture:", info.Config.Arch)
+		table.AddRow("CPUs:", cpuCountOrDefault(info.Config.CPUCount))
+
+		if cpu := info.Config.CPU; cpu != nil {
+			if cpu.MaxCount != 0 {
+				table.AddRow("Maximum CPUs:", cpu.MaxCount)
+			}
+			if cpu.Topology != nil {
+				table.AddRow("CPU topology:", cpu.Topology.String())
+			}
+			for _, affinity := range cpu.Affinity {
+				table.AddRow("CPU affinity:", fmt.Sprintf("vCPU %d on host CPUs %s",
+					affinity.VCPU, vmconfig.FormatCPUList(affinity.HostCPUs)))
+			}
+		}
+
+		table.AddRow("Memory:", memorySizeOrDefault(info.Config.MemorySize))
+
+		if memory := info.Config.Memory; memory != nil {
+			if memory.Hugepages {
+				table.AddRow("Huge pages:", hugepageSizeOrDefault(memory.HugepageSize))
+			}
+			if memory.Shared {
+				table.AddRow("Shared memory:", "yes")
+			}
+			if memory.HotplugSize != 0 {
+				table.AddRow("Memory hotplug:", fmt.Sprintf("up to %s more using %s",
+					humanize.IBytes(memory.HotplugSize), hotplugMethodOrDefault(memory.HotplugMethod)))
+			}
+		}
+
+		for _, numaNode := range info.Config.NUMANodes {
+			table.AddRow(fmt.Sprintf("NUMA node %d:", numaNode.ID), fmt.Sprintf("CPUs %s, %s of memory",
+				vmconfig.FormatCPUList(numaNode.CPUs), humanize.IBytes(numaNode.MemorySize)))
+		}
+
+		table.AddRow("MAC address:", info.Config.MACAddress.String())
+
+		for _, device := range info.Config.Devices {
+			table.AddRow("Device:", device.String())
+		}
+
+		if info.Config.Cmdline != "" {
+			table.AddRow("Kernel command-line:", info.Config.Cmdline)
+		}
+	}
+
+	if info.TartConfig != nil {
+		table.AddRow("Tart OS:", info.TartConfig.OS)
+		table.AddRow("Architecture:", info.TartConfig.Arch)
+		table.AddRow("CPUs:", cpuCountOrDefault(uint16(info.TartConfig.CPUCount)))
+		table.AddRow("Memory:", memorySizeOrDefault(info.TartConfig.MemorySize))
+		table.AddRow("MAC address:", info.TartConfig.MACAddress.String())
+	}
+
+	fmt.Println(table.String())
+
+	if len(info.Disks) != 0 {
+		disksTable := uitable.New()
+
+		disksTable.AddRow("Disk", "Apparent size", "Allocated size")
+
+		for _, disk := range info.Disks {
+			disksTable.AddRow(disk.Name, humanize.Bytes(disk.ApparentSize), humanize.Bytes(disk.AllocatedSize))
+		}
+
+		fmt.Println()
+		fmt.Println(disksTable.String())
+	}
+
+	if len(info.Attachments) != 0 {
+		attachmentsTable := uitable.New()
+
+		attachmentsTable.AddRow("Attached", "ID", "PCI address", "Path")
+
+		for _, attachment := range info.Attachments {
+			attachmentsTable.AddRow(attachment.Kind, attachment.ID, attachment.BDF, attachment.Path)
+		}
+
+		fmt.Println()
+		fmt.Println(attachmentsTable.String())
+	}
+
+	if info.Manifest != nil {
+		layersTable := uitable.New()
+
+		layersTable.AddRow("Media type", "Size", "Digest")
+
+		for _, layer := range info.Manifest.Layers {
+			layersTable.AddRow(layer.MediaType, humanize.Bytes(uint64(layer.Size)), layer.Digest)
+		}
+
+		fmt.Println()
+		fmt.Printf("Manifest %s:\n", info.Manifest.Digest)
+		fmt.Println(layersTable.String())
+	}
+}
+
+func cpuCountOrDefault(cpuCount uint16) string {
+	if cpuCount == 0 {
+		return "default"
+	}
+
+	return fmt.Sprintf("%d", cpuCount)
+}
+
+func memorySizeOrDefault(memorySize uint64) string {
+	if memorySize == 0 {
+		return "default"
+	}
+
+	return humanize.IBytes(memorySize)
+}
+
+func hugepageSizeOrDefault(hugepageSize uint64) string {
+	if hugepageSize == 0 {
+		return "default size"
+	}
+
+	return humanize.IBytes(hugepageSize)
+}
+
+func hotplugMethodOrDefault(hotplugMethod vmconfig.HotplugMethod) string {
+	if hotplugMethod == "" {
+		return string(vmconfig.HotplugMethodACPI)
+	}
+
+	return string(hotplugMethod)
+}
@@ -1,22 +1,29 @@
 package ip
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/avast/retry-go/v4"
 	"github.com/cirruslabs/vetu/internal/globallock"
 	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/network/arp"
+	"github.com/cirruslabs/vetu/internal/outputformat"
 	"github.com/cirruslabs/vetu/internal/storage/local"
 	"github.com/cirruslabs/vetu/internal/vmconfig"
 	"github.com/spf13/cobra"
-	"github.com/vishvananda/netlink"
-	"net"
+	"os"
 	"time"
 )
 
+type Info struct {
+	Name       string `json:"name"`
+	MACAddress string `json:"macAddress"`
+	IP         string `json:"ip"`
+}
+
 var wait uint16
+var format string
 
 var ErrIPNotFound = errors.New("VM's IP not found in the ARP cache, is the VM running?")
 
@@ -30,6 +37,7 @@ func NewCommand() *cobra.Command {
 
 	cmd.Flags().Uint16Var(&wait, "wait", 0,
 		"number of seconds to wait for a potential VM booting")
+	cmd.Flags().StringVar(&format, "format", outputformat.Text, outputformat.Usage)
 
 	return cmd
 }
@@ -37,6 +45,11 @@ func NewCommand() *cobra.Command {
 func runIP(cmd *cobra.Command, args []string) error {
 	name := args[0]
 
+	outputFormat, err := outputformat.Parse(format)
+	if err != nil {
+		return err
+	}
+
 	localName, err := localname.NewFromString(name)
 	if err != nil {
 		return err
@@ -73,34 +86,30 @@ func runIP(cmd *cobra.Command, args []string) error {
 			retry.Delay(time.Second), retry.DelayType(retry.FixedDelay))
 	}
 
-	err = retry.Do(func() error {
-		ip, err := arpTableLookup(hardwareAddr)
-		if err != nil {
-			return err
+	ip, err := retry.DoWithData(func() (string, error) {
+		ip, err := arp.Lookup(hardwareAddr)
+		if errors.Is(err, arp.ErrNotFound) {
+			return "", ErrIPNotFound
 		}
 
-		fmt.Println(ip)
-
-		return nil
+		return ip, err
 	}, retryOpts...)
 	if errors.Is(err, context.DeadlineExceeded) {
 		return ErrIPNotFound
 	}
-
-	return err
-}
-
-func arpTableLookup(hardwareAddr net.HardwareAddr) (string, error) {
-	neighbors, err := netlink.NeighList(0, 0)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	for _, neigh := range neighbors {
-		if bytes.Equal(neigh.HardwareAddr, hardwareAddr) {
-			return neigh.IP.String(), nil
-		}
+	if outputFormat.IsText() {
+		fmt.Println(ip)
+
+		return nil
 	}
 
-	return "", ErrIPNotFound
+	return outputFormat.Print(os.Stdout, &Info{
+		Name:       localName.String(),
+		MACAddress: hardwareAddr.String(),
+		IP:         ip,
+	})
 }
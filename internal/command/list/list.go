@@ -1,15 +1,26 @@
 package list
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/network/arp"
+	"github.com/cirruslabs/vetu/internal/outputformat"
 	"github.com/cirruslabs/vetu/internal/storage/local"
 	"github.com/cirruslabs/vetu/internal/storage/remote"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
 	"github.com/dustin/go-humanize"
 	"github.com/gosuri/uitable"
+	"github.com/opencontainers/go-digest"
 	"github.com/samber/lo"
 	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type desiredSource struct {
@@ -17,8 +28,32 @@ type desiredSource struct {
 	ListFunc func() ([]lo.Tuple2[string, *vmdirectory.VMDirectory], error)
 }
 
+type VM struct {
+	Source        string            `json:"source"`
+	Name          string            `json:"name"`
+	Reference     string            `json:"reference,omitempty"`
+	ApparentSize  uint64            `json:"apparentSize"`
+	AllocatedSize uint64            `json:"allocatedSize"`
+	SharedSize    uint64            `json:"sharedSize"`
+	State         vmdirectory.State `json:"state"`
+	PID           int32             `json:"pid,omitempty"`
+	MACAddress    string            `json:"macAddress"`
+	IP            string            `json:"ip,omitempty"`
+	CPUCount      uint16            `json:"cpuCount"`
+	MemorySize    uint64            `json:"memorySize"`
+	MemoryUsed    uint64            `json:"memoryUsed,omitempty"`
+	Origin        string            `json:"origin,omitempty"`
+
+	// vmDir is used to query the running VM outside of the global lock
+	vmDir *vmdirectory.VMDirectory
+}
+
 var source string
 var quiet bool
+var outdated bool
+var insecure bool
+var format string
+var filters []string
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -31,6 +66,12 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().StringVar(&source, "source", "",
 		"only display VMs from the specified source (e.g. --source local or --source oci)")
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "only display VM names")
+	cmd.Flags().BoolVar(&outdated, "outdated", false, "only display VMs whose origin tag "+
+		"now points to a different digest in the registry (e.g. a newer VM image was pushed)")
+	cmd.Flags().BoolVar(&insecure, "insecure", false,
+		"connect to the OCI registry via insecure HTTP protocol when using --outdated")
+	cmd.Flags().StringVar(&format, "format", outputformat.Text, outputformat.Usage)
+	cmd.Flags().StringArrayVar(&filters, "filter", []string{}, outputformat.FilterUsage)
 
 	return cmd
 }
@@ -38,6 +79,11 @@ func NewCommand() *cobra.Command {
 func runList(cmd *cobra.Command, args []string) error {
 	var desiredSources []desiredSource
 
+	outputFormat, err := outputformat.Parse(format)
+	if err != nil {
+		return err
+	}
+
 	// Support --source
 	switch source {
 	case "local":
@@ -54,63 +100,233 @@ func runList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("cannot display VMs from an unsupported source %q", source)
 	}
 
-	// Support -q/--quiet
-	if quiet {
-		for _, list := range desiredSources {
-			vms, err := list.ListFunc()
-			if err != nil {
-				return err
-			}
-
-			for _, vm := range vms {
-				name, _ := lo.Unpack2(vm)
+	// Support --outdated, we figure out which VMs are outdated
+	// in advance to avoid hitting the registry under a global lock
+	var filter func(vmDir *vmdirectory.VMDirectory) bool
 
-				fmt.Println(name)
-			}
+	if outdated {
+		outdatedPaths, err := findOutdated(cmd.Context(), desiredSources)
+		if err != nil {
+			return err
 		}
 
-		return nil
+		filter = func(vmDir *vmdirectory.VMDirectory) bool {
+			return outdatedPaths[vmDir.Path()]
+		}
 	}
 
-	table := uitable.New()
-
-	table.AddRow("Source", "Name", "Size", "State")
+	// Only the VM names are needed for -q/--quiet without --filter,
+	// so avoid the costly disk usage and the network lookups
+	namesOnly := quiet && len(filters) == 0
 
 	// Retrieve VMs metadata under a global lock
-	_, err := globallock.With(cmd.Context(), func() (struct{}, error) {
+	vms, err := globallock.With(cmd.Context(), func() ([]VM, error) {
+		var result []VM
+
 		for _, desiredSource := range desiredSources {
-			if err := addVMsToTable(table, desiredSource); err != nil {
-				return struct{}{}, err
+			vms, err := listVMs(desiredSource, filter, namesOnly)
+			if err != nil {
+				return nil, err
 			}
+
+			result = append(result, vms...)
 		}
 
-		return struct{}{}, nil
+		return result, nil
 	})
 	if err != nil {
 		return err
 	}
 
+	// Query the running VMs' API outside of the global lock,
+	// since an unresponsive VM would otherwise block other commands
+	for i := range vms {
+		if vms[i].State == vmdirectory.StateRunning {
+			vms[i].MemoryUsed = memoryUsed(cmd.Context(), vms[i].vmDir)
+		}
+	}
+
+	// Support --filter
+	vms, err = outputformat.Filter(vms, filters)
+	if err != nil {
+		return err
+	}
+
+	// Support -q/--quiet
+	if quiet {
+		for _, vm := range vms {
+			fmt.Println(vm.Name)
+		}
+
+		return nil
+	}
+
+	if !outputFormat.IsText() {
+		return outputformat.PrintList(os.Stdout, outputFormat, vms)
+	}
+
+	table := uitable.New()
+
+	table.AddRow("Source", "Name", "Apparent size", "Allocated size", "State", "Memory used", "Origin")
+
+	for _, vm := range vms {
+		var memoryUsed string
+
+		if vm.MemoryUsed != 0 {
+			memoryUsed = humanize.IBytes(vm.MemoryUsed)
+		}
+
+		table.AddRow(vm.Source, vm.Name, humanize.Bytes(vm.ApparentSize), humanize.Bytes(vm.AllocatedSize),
+			vm.State, memoryUsed, vm.Origin)
+	}
+
 	fmt.Println(table.String())
 
 	return nil
 }
 
-func addVMsToTable(table *uitable.Table, desiredSource desiredSource) error {
+func listVMs(
+	desiredSource desiredSource,
+	filter func(vmDir *vmdirectory.VMDirectory) bool,
+	namesOnly bool,
+) ([]VM, error) {
 	vms, err := desiredSource.ListFunc()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var result []VM
+
 	for _, vm := range vms {
 		name, vmDir := lo.Unpack2(vm)
 
-		size, err := vmDir.Size()
+		if filter != nil && !filter(vmDir) {
+			continue
+		}
+
+		if namesOnly {
+			result = append(result, VM{Source: desiredSource.Name, Name: name})
+
+			continue
+		}
+
+		vmInfo, err := newVM(desiredSource.Name, name, vmDir)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		table.AddRow(desiredSource.Name, name, humanize.Bytes(size), vmDir.State())
+		result = append(result, *vmInfo)
 	}
 
-	return nil
+	return result, nil
+}
+
+func newVM(source string, name string, vmDir *vmdirectory.VMDirectory) (*VM, error) {
+	vmConfig, err := vmDir.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	diskUsage, err := vmDir.DiskUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VM{
+		Source:        source,
+		Name:          name,
+		ApparentSize:  diskUsage.Apparent,
+		AllocatedSize: diskUsage.Allocated,
+		SharedSize:    diskUsage.Shared,
+		State:         vmdirectory.StateStopped,
+		PID:           vmDir.PID(),
+		MACAddress:    vmConfig.MACAddress.String(),
+		CPUCount:      vmConfig.CPUCount,
+		MemorySize:    vmConfig.MemorySize,
+		vmDir:         vmDir,
+	}
+
+	if result.PID != 0 {
+		result.State = vmdirectory.StateRunning
+
+		result.IP, err = arp.Lookup(vmConfig.MACAddress.HardwareAddr)
+		if err != nil && !errors.Is(err, arp.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	origin, err := vmDir.Origin()
+	if err != nil {
+		return nil, err
+	}
+	if origin != nil {
+		result.Origin = origin.RemoteName
+	}
+
+	// Figure out the fully-qualified reference with a digest,
+	// VMs in the OCI cache always know where they came from
+	var referenceName string
+	var referenceDigest digest.Digest
+
+	if source == "oci" {
+		referenceName = name
+		referenceDigest = digest.Digest(filepath.Base(vmDir.Path()))
+	} else if origin != nil {
+		referenceName = origin.RemoteName
+		referenceDigest = origin.Digest
+	}
+
+	if referenceName != "" && referenceDigest != "" {
+		reference, err := remotename.NewFromString(referenceName)
+		if err != nil {
+			return nil, err
+		}
+
+		reference.Tag = ""
+		reference.Digest = referenceDigest
+
+		result.Reference = reference.String()
+	}
+
+	return result, nil
+}
+
+// memoryUsed returns the amount of host memory actually used by the running VM,
+// which is the resident set size of its Cloud Hypervisor process, or zero
+// if it cannot be determined (e.g. when the VM has no API socket).
+func memoryUsed(ctx context.Context, vmDir *vmdirectory.VMDirectory) uint64 {
+	api, err := vmDir.API()
+	if err != nil {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	ping, err := api.Ping(ctx)
+	if err != nil || ping.PID == 0 {
+		return 0
+	}
+
+	status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(ping.PID)), "status"))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		// VmRSS is expressed in kibibytes (e.g. "VmRSS:\t  123456 kB")
+		value, ok := strings.CutPrefix(line, "VmRSS:")
+		if !ok {
+			continue
+		}
+
+		kibibytes, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0
+		}
+
+		return kibibytes * 1024
+	}
+
+	return 0
 }
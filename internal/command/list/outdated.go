@@ -0,0 +1,95 @@
+package list
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/cirruslabs/vetu/internal/dockerhosts"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/samber/lo"
+)
+
+// findOutdated returns the paths of the VMs whose origin tag now points
+// to a different digest in the registry. The digests are retrieved with
+// a HEAD request and are cached to avoid hitting the registry more than
+// once for the VMs with the same origin.
+func findOutdated(ctx context.Context, desiredSources []desiredSource) (map[string]bool, error) {
+	result := map[string]bool{}
+	latestDigests := map[string]digest.Digest{}
+
+	for _, desiredSource := range desiredSources {
+		vms, err := desiredSource.ListFunc()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, vm := range vms {
+			_, vmDir := lo.Unpack2(vm)
+
+			origin, err := vmDir.Origin()
+			if err != nil {
+				return nil, err
+			}
+
+			// We can only tell if the VM is outdated if it was pulled by tag
+			if origin == nil {
+				continue
+			}
+
+			originName, err := remotename.NewFromString(origin.RemoteName)
+			if err != nil {
+				return nil, err
+			}
+
+			if originName.Tag == "" {
+				continue
+			}
+
+			latestDigest, ok := latestDigests[origin.RemoteName]
+			if !ok {
+				latestDigest, err = headDigest(ctx, originName)
+				if err != nil {
+					// Don't fail the whole listing because of a single unreachable registry
+					_, _ = fmt.Fprintf(os.Stderr, "failed to check whether %s is outdated: %v\n",
+						origin.RemoteName, err)
+				}
+
+				latestDigests[origin.RemoteName] = latestDigest
+			}
+
+			if latestDigest != "" && latestDigest != origin.Digest {
+				result[vmDir.Path()] = true
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func headDigest(ctx context.Context, remoteName remotename.RemoteName) (digest.Digest, error) {
+	// Convert remoteName to ref.Ref that is used in github.com/regclient/regclient
+	reference, err := ref.New(remoteName.String())
+	if err != nil {
+		return "", err
+	}
+
+	// Load hosts from the Docker configuration file
+	hosts, err := dockerhosts.Load(reference, insecure)
+	if err != nil {
+		return "", err
+	}
+
+	// Initialize OCI registry client
+	client := regclient.New(regclient.WithConfigHost(hosts...))
+
+	manifest, err := client.ManifestHead(ctx, reference, regclient.WithManifestRequireDigest())
+	if err != nil {
+		return "", err
+	}
+
+	return manifest.GetDescriptor().Digest, nil
+}
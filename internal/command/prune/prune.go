@@ -0,0 +1,99 @@
+package prune
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/dustin/go-humanize"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+)
+
+var ErrPrune = errors.New("failed to prune the OCI cache")
+
+var limit string
+var all bool
+var dryRun bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Evict the least recently used VM images from the OCI cache",
+		Long: "Evict the least recently used VM images from the OCI cache until its size fits into the limit " +
+			"specified via --limit or VETU_CACHE_LIMIT environment variable (e.g. \"200GB\"), " +
+			"or all VM images when --all is specified.\n\n" +
+			"VM images are considered used when they are cloned or when the VMs cloned from them " +
+			"are run. VM images that are currently in use (for example, being cloned) are never evicted.\n\n" +
+			"When VETU_CACHE_LIMIT is set, the OCI cache is also pruned automatically after each pull.",
+		RunE: runPrune,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.Flags().StringVar(&limit, "limit", "",
+		"OCI cache size limit (e.g. \"200GB\"), defaults to the VETU_CACHE_LIMIT environment variable")
+	cmd.Flags().BoolVar(&all, "all", false,
+		"evict all VM images from the OCI cache that are not currently in use")
+	cmd.MarkFlagsMutuallyExclusive("limit", "all")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"only show the VM images that would be evicted, without actually evicting them")
+
+	return cmd
+}
+
+func runPrune(cmd *cobra.Command, args []string) error {
+	limitBytes, ok, err := remote.CacheLimit()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case all:
+		limitBytes = 0
+	case limit != "":
+		limitBytes, err = humanize.ParseBytes(limit)
+		if err != nil {
+			return fmt.Errorf("failed to parse --limit: %w", err)
+		}
+	case !ok:
+		return fmt.Errorf("%w: no OCI cache size limit specified, use --limit or VETU_CACHE_LIMIT "+
+			"environment variable, or --all to evict all VM images", ErrPrune)
+	}
+
+	evicted, err := globallock.With(cmd.Context(), func() ([]remote.Entry, error) {
+		return remote.Prune(limitBytes, dryRun)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(evicted) == 0 {
+		fmt.Println("nothing to prune, the OCI cache already fits into the limit")
+
+		return nil
+	}
+
+	table := uitable.New()
+
+	table.AddRow("Name", "Size", "Freed", "Last accessed")
+
+	var total uint64
+
+	for _, entry := range evicted {
+		table.AddRow(entry.Name, humanize.Bytes(entry.Size), humanize.Bytes(entry.Freed),
+			humanize.Time(entry.LastAccessed))
+
+		total += entry.Freed
+	}
+
+	fmt.Println(table.String())
+
+	if dryRun {
+		fmt.Printf("%s would be freed by evicting %d VM image(s)\n", humanize.Bytes(total), len(evicted))
+	} else {
+		fmt.Printf("freed %s by evicting %d VM image(s)\n", humanize.Bytes(total), len(evicted))
+	}
+
+	return nil
+}
@@ -1,15 +1,18 @@
 package push
 
 import (
+	"fmt"
 	"github.com/cirruslabs/vetu/internal/dockerhosts"
 	"github.com/cirruslabs/vetu/internal/filelock"
 	"github.com/cirruslabs/vetu/internal/globallock"
 	"github.com/cirruslabs/vetu/internal/name/localname"
 	"github.com/cirruslabs/vetu/internal/name/remotename"
 	"github.com/cirruslabs/vetu/internal/oci"
+	"github.com/cirruslabs/vetu/internal/oci/diskcompression"
 	"github.com/cirruslabs/vetu/internal/storage/local"
 	"github.com/cirruslabs/vetu/internal/storage/remote"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/spf13/cobra"
@@ -17,6 +20,12 @@ import (
 
 var populateCache bool
 var insecure bool
+var chunkSize string
+var concurrency uint8
+var base string
+var compression string
+var compressionLevel int
+var appendToIndex bool
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -30,6 +39,24 @@ func NewCommand() *cobra.Command {
 		"increases disk usage, but saves time if you're going to pull the pushed images shortly thereafter")
 	cmd.Flags().BoolVar(&insecure, "insecure", false,
 		"connect to the OCI registry via insecure HTTP protocol")
+	cmd.Flags().StringVar(&chunkSize, "chunk-size", humanize.Bytes(oci.DefaultDiskLayerSizeBytes),
+		"size of the disk windows that are compressed into separate disk layers, disk layers are spooled "+
+			"to temporary files before uploading, so this affects the temporary disk space usage "+
+			"(up to --concurrency compressed disk layers) and the upload granularity, but not the memory usage")
+	cmd.Flags().Uint8Var(&concurrency, "concurrency", 4,
+		"number of disk layers to compress and upload in parallel when pushing a VM, this bounds "+
+			"the memory usage of the push, since each of the disk layers in progress only keeps "+
+			"the compressor's state and a small copy buffer in memory, regardless of the --chunk-size")
+	cmd.Flags().StringVar(&compression, "compression", string(diskcompression.AlgorithmLZ4),
+		"compression algorithm for the disk layers: lz4, zstd or none, zstd provides better compression "+
+			"ratio at the cost of a slower push")
+	cmd.Flags().IntVar(&compressionLevel, "compression-level", 0, "compression level for the disk layers "+
+		"(1-9 for lz4 and 1-22 for zstd), uses the algorithm's default level when not specified")
+	cmd.Flags().BoolVar(&appendToIndex, "append-to-index", false, "add the VM image to the image index "+
+		"that REMOTE_NAME points to (creating one if needed) instead of overwriting it, replacing the VM image "+
+		"for the same platform, this allows publishing VM images for multiple architectures under the same tag")
+	cmd.Flags().StringVar(&base, "base", "", "remote name of a previously pushed VM image whose disk "+
+		"layers will be reused for the disk windows that haven't changed (e.g. --base ghcr.io/org/vm:v1)")
 
 	return cmd
 }
@@ -38,6 +65,25 @@ func runPush(cmd *cobra.Command, args []string) error {
 	srcName := args[0]
 	dstName := args[1]
 
+	// Parse --chunk-size
+	chunkSizeBytes, err := humanize.ParseBytes(chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to parse --chunk-size: %v", err)
+	}
+	if chunkSizeBytes == 0 {
+		return fmt.Errorf("--chunk-size cannot be zero")
+	}
+
+	if concurrency == 0 {
+		return fmt.Errorf("--concurrency cannot be zero")
+	}
+
+	// Parse --compression and --compression-level
+	diskCompression, err := diskcompression.New(compression, compressionLevel)
+	if err != nil {
+		return fmt.Errorf("failed to parse --compression: %w", err)
+	}
+
 	// Parse srcName
 	srcLocalName, err := localname.NewFromString(srcName)
 	if err != nil {
@@ -72,14 +118,46 @@ func runPush(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if appendToIndex && dstRemoteName.Digest != "" {
+		return fmt.Errorf("--append-to-index requires REMOTE_NAME to be referenced by tag, not by digest")
+	}
+
 	// Convert dstRemoteName to ref.Ref that is used in github.com/regclient/regclient
 	reference, err := ref.New(dstRemoteName.String())
 	if err != nil {
 		return err
 	}
 
+	pushOpts := oci.PushOptions{
+		DiskLayerSizeBytes: int(chunkSizeBytes),
+		Concurrency:        int(concurrency),
+		Compression:        diskCompression,
+		AppendToIndex:      appendToIndex,
+	}
+
+	// Parse --base
+	if base != "" {
+		baseRemoteName, err := remotename.NewFromString(base)
+		if err != nil {
+			return fmt.Errorf("failed to parse --base: %w", err)
+		}
+
+		baseReference, err := ref.New(baseRemoteName.String())
+		if err != nil {
+			return err
+		}
+
+		pushOpts.Base = &baseReference
+	}
+
 	// Load hosts from the Docker configuration file
-	hosts, err := dockerhosts.Load(reference, insecure)
+	var additionalReferences []ref.Ref
+
+	if pushOpts.Base != nil {
+		additionalReferences = append(additionalReferences, *pushOpts.Base)
+	}
+
+	hosts, err := dockerhosts.Load(reference, insecure, additionalReferences...)
 	if err != nil {
 		return err
 	}
@@ -88,7 +166,7 @@ func runPush(cmd *cobra.Command, args []string) error {
 	client := regclient.New(regclient.WithConfigHost(hosts...))
 
 	// Push the VM image
-	digest, err := oci.PushVMDirectory(cmd.Context(), client, vmDir, reference)
+	digest, err := oci.PushVMDirectory(cmd.Context(), client, vmDir, reference, pushOpts)
 	if err != nil {
 		return err
 	}
@@ -1,19 +1,31 @@
 package command
 
 import (
+	"github.com/cirruslabs/vetu/internal/command/attach"
+	"github.com/cirruslabs/vetu/internal/command/balloon"
 	"github.com/cirruslabs/vetu/internal/command/clone"
+	"github.com/cirruslabs/vetu/internal/command/compact"
 	"github.com/cirruslabs/vetu/internal/command/create"
 	deletepkg "github.com/cirruslabs/vetu/internal/command/delete"
+	"github.com/cirruslabs/vetu/internal/command/detach"
+	"github.com/cirruslabs/vetu/internal/command/device"
+	"github.com/cirruslabs/vetu/internal/command/disk"
+	"github.com/cirruslabs/vetu/internal/command/du"
+	"github.com/cirruslabs/vetu/internal/command/export"
 	"github.com/cirruslabs/vetu/internal/command/fqn"
+	importpkg "github.com/cirruslabs/vetu/internal/command/import"
+	"github.com/cirruslabs/vetu/internal/command/inspect"
 	"github.com/cirruslabs/vetu/internal/command/ip"
 	"github.com/cirruslabs/vetu/internal/command/list"
 	"github.com/cirruslabs/vetu/internal/command/login"
 	"github.com/cirruslabs/vetu/internal/command/logout"
+	"github.com/cirruslabs/vetu/internal/command/prune"
 	"github.com/cirruslabs/vetu/internal/command/pull"
 	"github.com/cirruslabs/vetu/internal/command/push"
 	"github.com/cirruslabs/vetu/internal/command/run"
 	"github.com/cirruslabs/vetu/internal/command/set"
 	"github.com/cirruslabs/vetu/internal/command/stop"
+	"github.com/cirruslabs/vetu/internal/command/verify"
 	"github.com/cirruslabs/vetu/internal/globallock"
 	"github.com/cirruslabs/vetu/internal/storage/remote"
 	"github.com/cirruslabs/vetu/internal/storage/temporary"
@@ -54,6 +66,18 @@ func NewRootCmd() *cobra.Command {
 		stop.NewCommand(),
 		deletepkg.NewCommand(),
 		fqn.NewCommand(),
+		export.NewCommand(),
+		importpkg.NewCommand(),
+		verify.NewCommand(),
+		inspect.NewCommand(),
+		prune.NewCommand(),
+		du.NewCommand(),
+		disk.NewCommand(),
+		compact.NewCommand(),
+		balloon.NewCommand(),
+		attach.NewCommand(),
+		detach.NewCommand(),
+		device.NewCommand(),
 	)
 
 	return cmd
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,12 +14,15 @@ import (
 	"github.com/cirruslabs/vetu/internal/filelock"
 	"github.com/cirruslabs/vetu/internal/globallock"
 	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
 	"github.com/cirruslabs/vetu/internal/network"
 	"github.com/cirruslabs/vetu/internal/network/bridged"
 	"github.com/cirruslabs/vetu/internal/network/host"
 	"github.com/cirruslabs/vetu/internal/network/software"
 	"github.com/cirruslabs/vetu/internal/pidlock"
 	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/vfio"
 	"github.com/cirruslabs/vetu/internal/vmconfig"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
 	"github.com/samber/lo"
@@ -48,9 +51,10 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().IntVar(&netHostMTU, "net-host-mtu", 0,
 		"MTU to use for the host networking interface")
 	cmd.Flags().StringArrayVar(&devices, "device", []string{},
-		"direct device assignment `parameters` to pass to the Cloud Hypervisor command, can be "+
-			"repeated multiple times to attach multiple devices (e.g. "+
-			"--device=\"path=/sys/bus/pci/devices/0000:01:00.0/,iommu=on\")")
+		"PCI address of the device to pass through (e.g. --device=0000:01:00.0) or direct device "+
+			"assignment `parameters` to pass to the Cloud Hypervisor command, can be repeated multiple "+
+			"times to attach multiple devices in addition to the ones configured with \"vetu set --device\" "+
+			"(e.g. --device=\"path=/sys/bus/pci/devices/0000:01:00.0/,iommu=on\")")
 
 	return cmd
 }
@@ -80,6 +84,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 			return nil, err
 		}
 
+		if err := touch(vmDir); err != nil {
+			return nil, err
+		}
+
 		return vmDir, nil
 	})
 	if err != nil {
@@ -109,6 +117,13 @@ func runRun(cmd *cobra.Command, args []string) error {
 			vmConfig.Arch, runtime.GOARCH)
 	}
 
+	// Validate the devices upfront, otherwise the Cloud Hypervisor
+	// fails with the same error for all of the VFIO misconfigurations
+	vmDevices, err := collectDevices(vmConfig)
+	if err != nil {
+		return err
+	}
+
 	// Initialize network
 	network, err := globallock.With(cmd.Context(), func() (network.Network, error) {
 		switch {
@@ -145,8 +160,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	// Disks
 	diskArguments := lo.Map(vmConfig.Disks, func(disk vmconfig.Disk, index int) string {
-		path := filepath.Join(vmDir.Path(), disk.Name)
-		return fmt.Sprintf("path=%s", path)
+		return disk.CloudHypervisorArgument(vmDir.Path())
 	})
 	if len(diskArguments) != 0 {
 		hvArgs = append(hvArgs, "--disk")
@@ -154,13 +168,54 @@ func runRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// CPU and memory
-	if cpuCount := vmConfig.CPUCount; cpuCount != 0 {
-		hvArgs = append(hvArgs, "--cpus", fmt.Sprintf("boot=%d", cpuCount))
+	hvArgs = append(hvArgs, vmConfig.CPUAndMemoryArguments()...)
+
+	// API socket, which is used by the commands that
+	// operate on the running VM (e.g. "vetu balloon")
+	if apiSocketPath := vmDir.APISocketPath(); len(apiSocketPath) <= vmdirectory.MaxAPISocketPathLength {
+		// Remove the stale API socket that might've been left after a crash
+		if err := os.Remove(apiSocketPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		defer func() {
+			_ = os.Remove(apiSocketPath)
+		}()
+
+		hvArgs = append(hvArgs, "--api-socket", fmt.Sprintf("path=%s", apiSocketPath))
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "VM's path is too long to create the Cloud Hypervisor's API socket, "+
+			"commands that operate on the running VM will be unavailable\n")
+	}
+
+	// Disks and devices attached by the previous "vetu run" are gone
+	if err := vmDir.ResetAttachments(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = vmDir.ResetAttachments()
+	}()
+
+	// "vetu set --live" needs the memory size that the VM was started
+	// with to know how much memory can still be hotplugged using ACPI
+	if err := vmDir.ResetBootMemory(); err != nil {
+		return err
 	}
+	if vmConfig.MemorySize != 0 {
+		bootMemory := vmdirectory.BootMemory{
+			Size: vmConfig.MemorySize,
+		}
+
+		if vmConfig.Memory != nil {
+			bootMemory.HotplugSize = vmConfig.Memory.HotplugSize
+		}
 
-	if memorySize := vmConfig.MemorySize; memorySize != 0 {
-		hvArgs = append(hvArgs, "--memory", fmt.Sprintf("size=%d", memorySize))
+		if err := vmDir.SetBootMemory(bootMemory); err != nil {
+			return err
+		}
 	}
+	defer func() {
+		_ = vmDir.ResetBootMemory()
+	}()
 
 	// Networking
 	netOpts := []string{"fd=3", fmt.Sprintf("mac=%s", vmConfig.MACAddress)}
@@ -172,8 +227,8 @@ func runRun(cmd *cobra.Command, args []string) error {
 	hvArgs = append(hvArgs, "--net", strings.Join(netOpts, ","))
 
 	// Devices
-	for _, device := range devices {
-		hvArgs = append(hvArgs, "--device", device)
+	for _, device := range vmDevices {
+		hvArgs = append(hvArgs, "--device", device.String())
 	}
 
 	// Reduce VirtIO IOMMU address width from 64 to 39 bits
@@ -181,7 +236,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 	// mappings on amd64[1].
 	//
 	// [1]: https://github.com/cloud-hypervisor/cloud-hypervisor/pull/6900
-	if runtime.GOARCH == "amd64" && len(devices) != 0 {
+	if runtime.GOARCH == "amd64" && len(vmDevices) != 0 {
 		hvArgs = append(hvArgs, "--platform", "iommu_address_width=39")
 	}
 
@@ -225,3 +280,69 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// touch updates the last accessed time of the VM and of the VM image
+// in the OCI cache that it was cloned from (if any), so that the latter
+// is not evicted from the OCI cache while it's still being used.
+func touch(vmDir *vmdirectory.VMDirectory) error {
+	now := time.Now()
+
+	if err := vmDir.SetLastAccessed(now); err != nil {
+		return err
+	}
+
+	origin, err := vmDir.Origin()
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Digest == "" {
+		return nil
+	}
+
+	originName, err := remotename.NewFromString(origin.RemoteName)
+	if err != nil {
+		return err
+	}
+
+	originName.Tag = ""
+	originName.Digest = origin.Digest
+
+	if !remote.Exists(originName) {
+		return nil
+	}
+
+	originVMDir, err := remote.Open(originName)
+	if err != nil {
+		return err
+	}
+
+	return originVMDir.SetLastAccessed(now)
+}
+
+// collectDevices returns the devices configured for the VM and
+// the ones passed via --device, ensuring that they can be assigned.
+func collectDevices(vmConfig *vmconfig.VMConfig) ([]vmconfig.Device, error) {
+	result := slices.Clone(vmConfig.Devices)
+
+	for _, device := range devices {
+		parsedDevice, err := vmconfig.ParseDevice(device)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, parsedDevice)
+	}
+
+	for _, device := range result {
+		bdf, ok := device.BDF()
+		if !ok {
+			continue
+		}
+
+		if err := vfio.Validate(bdf); err != nil {
+			return nil, fmt.Errorf("cannot pass through device %s: %w", bdf, err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package set
+
+import (
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"slices"
+	"strings"
+)
+
+// liveFlags are the flags that can be used together with --live
+var liveFlags = []string{"live", "cpu", "memory"}
+
+// runSetLive resizes the running VM's CPUs and memory using the Cloud Hypervisor's
+// vm.resize API, and updates the VM's configuration to keep it in sync.
+func runSetLive(cmd *cobra.Command, localName localname.LocalName) error {
+	var unsupportedFlags []string
+
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if !slices.Contains(liveFlags, flag.Name) {
+			unsupportedFlags = append(unsupportedFlags, "--"+flag.Name)
+		}
+	})
+
+	if len(unsupportedFlags) != 0 {
+		return fmt.Errorf("%w: %s cannot be changed on a running VM, omit --live and restart the VM instead",
+			ErrSet, strings.Join(unsupportedFlags, ", "))
+	}
+
+	if cpu == 0 && memory == 0 {
+		return fmt.Errorf("%w: --live requires --cpu and/or --memory", ErrSet)
+	}
+
+	// The running VM's directory is locked by "vetu run", so we hold
+	// the global lock instead to avoid the concurrent configuration changes
+	_, err := globallock.With(cmd.Context(), func() (struct{}, error) {
+		vmDir, err := local.Open(localName)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		if !vmDir.Running() {
+			return struct{}{}, fmt.Errorf("%w: VM %s is not running, omit --live to change "+
+				"the configuration that will be used on the next boot", ErrSet, localName)
+		}
+
+		vmConfig, err := vmDir.Config()
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		api, err := vmDir.API()
+		if err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrSet, err)
+		}
+
+		info, err := api.Info(cmd.Context())
+		if err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrSet, err)
+		}
+
+		var resizeRequest cloudhypervisor.ResizeRequest
+
+		if cpu != 0 {
+			if err := checkCPUHeadroom(&info.Config.CPUs, cpu); err != nil {
+				return struct{}{}, err
+			}
+
+			if cpu != info.Config.CPUs.BootVCPUs {
+				resizeRequest.DesiredVCPUs = &cpu
+			}
+
+			vmConfig.CPUCount = cpu
+		}
+
+		if memory != 0 {
+			desiredMemorySize := memory * 1024 * 1024
+
+			bootMemory, err := vmDir.BootMemory()
+			if err != nil {
+				return struct{}{}, err
+			}
+
+			if err := checkMemoryHeadroom(&info.Config.Memory, bootMemory, desiredMemorySize); err != nil {
+				return struct{}{}, err
+			}
+
+			if desiredMemorySize != info.Config.Memory.CurrentSize() {
+				resizeRequest.DesiredRAM = &desiredMemorySize
+			}
+
+			vmConfig.MemorySize = desiredMemorySize
+		}
+
+		// Validate the configuration before resizing the VM to avoid
+		// leaving the VM in a state that cannot be persisted
+		if err := vmConfig.Validate(); err != nil {
+			return struct{}{}, fmt.Errorf("%w: %v", ErrSet, err)
+		}
+
+		if resizeRequest != (cloudhypervisor.ResizeRequest{}) {
+			if err := api.Resize(cmd.Context(), resizeRequest); err != nil {
+				return struct{}{}, fmt.Errorf("%w: %v", ErrSet, err)
+			}
+		}
+
+		return struct{}{}, vmDir.SetConfig(vmConfig)
+	})
+
+	return err
+}
+
+func checkCPUHeadroom(cpus *cloudhypervisor.InfoCPUs, desiredCPUCount uint16) error {
+	if desiredCPUCount > cpus.MaxVCPUs {
+		return fmt.Errorf("%w: VM was started with up to %d CPUs, which is not enough for %d CPUs, "+
+			"use \"vetu set --cpu-max\" and restart the VM to allow the CPU hotplug",
+			ErrSet, cpus.MaxVCPUs, desiredCPUCount)
+	}
+
+	return nil
+}
+
+func checkMemoryHeadroom(
+	memory *cloudhypervisor.InfoMemory,
+	bootMemory *vmdirectory.BootMemory,
+	desiredMemorySize uint64,
+) error {
+	currentMemorySize := memory.CurrentSize()
+
+	if desiredMemorySize == currentMemorySize {
+		return nil
+	}
+
+	if memory.HotplugSize == 0 {
+		return fmt.Errorf("%w: VM was started without the memory hotplug headroom, use "+
+			"\"vetu set --memory-hotplug-size\" and restart the VM to allow the memory hotplug", ErrSet)
+	}
+
+	maxMemorySize := memory.Size + memory.HotplugSize
+
+	// Only virtio-mem supports unplugging the memory, and its
+	// headroom is fixed, unlike with ACPI, where the Cloud Hypervisor
+	// tracks the hotplugged memory as a part of the memory size
+	if memory.HotplugMethod != "VirtioMem" {
+		if desiredMemorySize < currentMemorySize {
+			return fmt.Errorf("%w: VM's memory can only be increased with the ACPI memory hotplug, "+
+				"use \"vetu set --memory-hotplug-method virtio-mem\" and restart the VM to allow "+
+				"decreasing the memory", ErrSet)
+		}
+
+		// Without the memory size that the VM was started with (e.g. when
+		// it was started by an older vetu version) the headroom is unknown,
+		// so let the Cloud Hypervisor reject the excessive memory size
+		if bootMemory == nil {
+			return nil
+		}
+
+		maxMemorySize = bootMemory.MaxSize()
+	}
+
+	if desiredMemorySize > maxMemorySize {
+		return fmt.Errorf("%w: VM was started with up to %s of memory, which is not enough for %s, use "+
+			"\"vetu set --memory-hotplug-size\" and restart the VM to increase the memory hotplug headroom",
+			ErrSet, humanize.IBytes(maxMemorySize), humanize.IBytes(desiredMemorySize))
+	}
+
+	return nil
+}
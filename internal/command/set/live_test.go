@@ -0,0 +1,49 @@
+package set
+
+import (
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const gib = 1024 * 1024 * 1024
+
+func TestCheckMemoryHeadroomACPI(t *testing.T) {
+	bootMemory := &vmdirectory.BootMemory{Size: 4 * gib, HotplugSize: 2 * gib}
+
+	// Cloud Hypervisor grows the memory size on ACPI memory
+	// hotplug, so the headroom is relative to the boot memory
+	memory := &cloudhypervisor.InfoMemory{Size: 5 * gib, HotplugSize: 2 * gib, HotplugMethod: "Acpi"}
+
+	require.NoError(t, checkMemoryHeadroom(memory, bootMemory, 5*gib))
+	require.NoError(t, checkMemoryHeadroom(memory, bootMemory, 6*gib))
+	require.ErrorIs(t, checkMemoryHeadroom(memory, bootMemory, 7*gib), ErrSet)
+
+	// Memory cannot be unplugged with ACPI
+	require.ErrorIs(t, checkMemoryHeadroom(memory, bootMemory, 4*gib), ErrSet)
+
+	// Without the boot memory, only the Cloud Hypervisor knows the headroom
+	require.NoError(t, checkMemoryHeadroom(memory, nil, 7*gib))
+
+	// Memory hotplug requires the headroom
+	memory = &cloudhypervisor.InfoMemory{Size: 4 * gib, HotplugMethod: "Acpi"}
+
+	require.ErrorIs(t, checkMemoryHeadroom(memory, &vmdirectory.BootMemory{Size: 4 * gib}, 5*gib), ErrSet)
+}
+
+func TestCheckMemoryHeadroomVirtioMem(t *testing.T) {
+	bootMemory := &vmdirectory.BootMemory{Size: 4 * gib, HotplugSize: 2 * gib}
+
+	// virtio-mem keeps the memory size and tracks the hotplugged memory separately
+	memory := &cloudhypervisor.InfoMemory{Size: 4 * gib, HotplugSize: 2 * gib, HotpluggedSize: gib,
+		HotplugMethod: "VirtioMem"}
+
+	require.NoError(t, checkMemoryHeadroom(memory, bootMemory, 5*gib))
+	require.NoError(t, checkMemoryHeadroom(memory, bootMemory, 6*gib))
+	require.ErrorIs(t, checkMemoryHeadroom(memory, bootMemory, 7*gib), ErrSet)
+
+	// Memory can be unplugged with virtio-mem
+	require.NoError(t, checkMemoryHeadroom(memory, bootMemory, 4*gib))
+	require.NoError(t, checkMemoryHeadroom(memory, nil, 4*gib))
+}
@@ -10,14 +10,31 @@ import (
 	"github.com/cirruslabs/vetu/internal/vmconfig"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
 	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
-var cpu uint8
+var cpu uint16
+var cpuMax uint16
+var cpuTopology string
+var cpuAffinity []string
 var memory uint64
+var memoryShared bool
+var memoryHugepages bool
+var memoryHugepageSize string
+var numaNodes []string
+var balloon string
+var balloonDeflateOnOOM bool
+var balloonFreePageReporting bool
+var memoryHotplugSize string
+var memoryHotplugMethod string
 var diskSize uint16
+var diskOptions []string
+var devices []string
+var live bool
 
 var ErrSet = errors.New("failed to set VM configuration")
 
@@ -29,11 +46,52 @@ func NewCommand() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 	}
 
-	cmd.Flags().Uint8Var(&cpu, "cpu", 0, "number of VM CPUs to use for the VM")
+	cmd.Flags().Uint16Var(&cpu, "cpu", 0, "number of VM CPUs to use for the VM")
+	cmd.Flags().Uint16Var(&cpuMax, "cpu-max", 0, "maximum number of VM CPUs, "+
+		"the CPUs above the --cpu can be hotplugged (0 resets to the number of VM CPUs)")
+	cmd.Flags().StringVar(&cpuTopology, "cpu-topology", "", "CPU topology in the "+
+		"THREADS_PER_CORE:CORES_PER_DIE:DIES_PER_PACKAGE:PACKAGES format, which should describe "+
+		"the maximum number of VM CPUs (\"none\" resets the topology)")
+	cmd.Flags().StringArrayVar(&cpuAffinity, "cpu-affinity", []string{}, "pin the VM CPU to the "+
+		"host CPUs in the VCPU:HOST_CPUS format (e.g. --cpu-affinity 0:2-3), can be specified "+
+		"multiple times and replaces the existing pinning (\"none\" resets the pinning)")
 	cmd.Flags().Uint64Var(&memory, "memory", 0, "amount of memory to use "+
 		"for the VM in MiB (mebibytes)")
+	cmd.Flags().BoolVar(&memoryShared, "memory-shared", false, "map the VM's memory as shared, "+
+		"which is needed for the vhost-user devices")
+	cmd.Flags().BoolVar(&memoryHugepages, "memory-hugepages", false, "back the VM's memory "+
+		"with the huge pages, which need to be reserved on the host beforehand")
+	cmd.Flags().StringVar(&memoryHugepageSize, "memory-hugepage-size", "", "size of the huge pages "+
+		"(e.g. 2MiB or 1GiB), the host's default huge page size is used by default (\"default\" resets the size)")
+	cmd.Flags().StringVar(&memoryHotplugSize, "memory-hotplug-size", "", "amount of memory that can be "+
+		"hotplugged into the running VM in addition to the --memory using \"vetu set --live\" (e.g. 4GiB, "+
+		"0 disables the memory hotplug)")
+	cmd.Flags().StringVar(&memoryHotplugMethod, "memory-hotplug-method", "", "memory hotplug method, "+
+		"either \"acpi\" (the default, only allows adding memory) or \"virtio-mem\" "+
+		"(\"default\" resets the method)")
+	cmd.Flags().StringArrayVar(&numaNodes, "numa-node", []string{}, "guest NUMA node in the "+
+		"ID:CPUS:MEMORY_SIZE[:DISTANCES] format (e.g. --numa-node 0:0-3:4GiB:1@20), can be specified "+
+		"multiple times and replaces the existing NUMA nodes (\"none\" resets the NUMA nodes)")
+	cmd.Flags().StringVar(&balloon, "balloon", "", "add a memory balloon device with the specified "+
+		"initial size (e.g. 0 or 1GiB), which can be resized at run-time using \"vetu balloon\" to reclaim "+
+		"the VM's memory (\"none\" removes the balloon device)")
+	cmd.Flags().BoolVar(&balloonDeflateOnOOM, "balloon-deflate-on-oom", false, "deflate the memory "+
+		"balloon when the guest runs out of memory")
+	cmd.Flags().BoolVar(&balloonFreePageReporting, "balloon-free-page-reporting", false, "make the guest "+
+		"report its free memory pages to the memory balloon, which returns them to the host")
 	cmd.Flags().Uint16Var(&diskSize, "disk-size", 0, "resize the primary VMs disk "+
 		"to the specified size in GB (note that the disk size can only be increased to avoid losing data)")
+	cmd.Flags().StringArrayVar(&diskOptions, "disk-option", []string{}, "set disk options in the "+
+		"DISK:KEY=VALUE[,KEY=VALUE...] format (e.g. --disk-option \"data.img:readonly=on,serial=data\"), "+
+		"an empty value resets the option, can be specified multiple times, supported options are: "+
+		strings.Join(vmconfig.DiskOptions, ", "))
+	cmd.Flags().StringArrayVar(&devices, "device", []string{}, "PCI address of the device to pass through "+
+		"(e.g. --device 0000:01:00.0) or direct device assignment parameters in the same format as for "+
+		"\"vetu run --device\", can be specified multiple times and replaces the existing devices "+
+		"(\"none\" removes all devices), use \"vetu device bind\" to prepare the device beforehand")
+	cmd.Flags().BoolVar(&live, "live", false, "resize the running VM's CPUs (--cpu) and memory (--memory) "+
+		"and update its configuration, which requires the VM to be started with the CPU hotplug headroom "+
+		"(--cpu-max) and/or the memory hotplug headroom (--memory-hotplug-size)")
 
 	return cmd
 }
@@ -46,6 +104,10 @@ func runSet(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if live {
+		return runSetLive(cmd, localName)
+	}
+
 	// Open and lock VM directory (under a global lock) until the end of the "vetu set" execution
 	vmDir, err := globallock.With(cmd.Context(), func() (*vmdirectory.VMDirectory, error) {
 		vmDir, err := local.Open(localName)
@@ -81,6 +143,43 @@ func runSet(cmd *cobra.Command, args []string) error {
 		vmConfig.MemorySize = memory * 1024 * 1024
 	}
 
+	if err := setCPUAndMemoryOptions(cmd, vmConfig); err != nil {
+		return err
+	}
+
+	if err := setBalloonOptions(cmd, vmConfig); err != nil {
+		return err
+	}
+
+	for _, diskOption := range diskOptions {
+		if err := setDiskOptions(vmConfig, diskOption); err != nil {
+			return err
+		}
+	}
+
+	if len(devices) != 0 {
+		vmConfig.Devices = nil
+
+		for _, rawDevice := range devices {
+			if rawDevice == "none" {
+				continue
+			}
+
+			device, err := vmconfig.ParseDevice(rawDevice)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSet, err)
+			}
+
+			vmConfig.Devices = append(vmConfig.Devices, device)
+		}
+	}
+
+	if err := vmConfig.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrSet, err)
+	}
+
+	// Resize the disk only once the configuration is known to be valid,
+	// to avoid growing the disk when the configuration cannot be saved
 	if diskSize != 0 {
 		if err := resizeDisk(vmDir, vmConfig); err != nil {
 			return err
@@ -95,10 +194,17 @@ func resizeDisk(vmDir *vmdirectory.VMDirectory, vmConfig *vmconfig.VMConfig) err
 		return fmt.Errorf("%w: VM has no disks", ErrSet)
 	}
 
+	// Truncating doesn't change the virtual size of a QCOW2 image and may corrupt it
+	if vmConfig.Disks[0].ImageType == vmconfig.ImageTypeQCOW2 {
+		return fmt.Errorf("%w: disk %s is a QCOW2 image, only raw disks can be resized",
+			ErrSet, vmConfig.Disks[0].Name)
+	}
+
 	diskFile, err := os.OpenFile(filepath.Join(vmDir.Path(), vmConfig.Disks[0].Name), os.O_RDWR, 0600)
 	if err != nil {
 		return fmt.Errorf("%w: failed to open disk %s: %v", ErrSet, vmConfig.Disks[0].Name, err)
 	}
+	defer diskFile.Close()
 
 	diskStat, err := diskFile.Stat()
 	if err != nil {
@@ -109,7 +215,8 @@ func resizeDisk(vmDir *vmdirectory.VMDirectory, vmConfig *vmconfig.VMConfig) err
 	desiredDiskSizeBytes := int64(diskSize) * humanize.GByte
 
 	if actualDiskSizeBytes := diskStat.Size(); desiredDiskSizeBytes < actualDiskSizeBytes {
-		return fmt.Errorf("%w: new disk size of %s should be larger than the current disk size of %s",
+		return fmt.Errorf("%w: new disk size of %s should be larger than the current disk size of %s "+
+			"(use \"vetu disk shrink\" to shrink the disk to fit its partitions)",
 			ErrSet, humanize.Bytes(uint64(desiredDiskSizeBytes)), humanize.Bytes(uint64(actualDiskSizeBytes)))
 	}
 
@@ -123,3 +230,179 @@ func resizeDisk(vmDir *vmdirectory.VMDirectory, vmConfig *vmconfig.VMConfig) err
 
 	return nil
 }
+
+func setDiskOptions(vmConfig *vmconfig.VMConfig, diskOption string) error {
+	diskName, rawOptions, ok := strings.Cut(diskOption, ":")
+	if !ok || rawOptions == "" {
+		return fmt.Errorf("%w: disk option %q should be in the DISK:KEY=VALUE[,KEY=VALUE...] format",
+			ErrSet, diskOption)
+	}
+
+	_, index, ok := lo.FindIndexOf(vmConfig.Disks, func(disk vmconfig.Disk) bool {
+		return disk.Name == diskName
+	})
+	if !ok {
+		return fmt.Errorf("%w: VM has no disk named %q", ErrSet, diskName)
+	}
+
+	disk := &vmConfig.Disks[index]
+
+	for _, rawOption := range strings.Split(rawOptions, ",") {
+		key, value, ok := strings.Cut(rawOption, "=")
+		if !ok {
+			return fmt.Errorf("%w: disk option %q should be in the KEY=VALUE format", ErrSet, rawOption)
+		}
+
+		if err := disk.SetOption(key, value); err != nil {
+			return fmt.Errorf("%w: %v", ErrSet, err)
+		}
+	}
+
+	if err := disk.Validate(); err != nil {
+		return fmt.Errorf("%w: disk %q: %v", ErrSet, diskName, err)
+	}
+
+	return nil
+}
+
+func setCPUAndMemoryOptions(cmd *cobra.Command, vmConfig *vmconfig.VMConfig) error {
+	cpuOptions := lo.FromPtr(vmConfig.CPU)
+	memoryOptions := lo.FromPtr(vmConfig.Memory)
+
+	if cmd.Flags().Changed("cpu-max") {
+		cpuOptions.MaxCount = cpuMax
+	}
+
+	if cpuTopology == "none" {
+		cpuOptions.Topology = nil
+	} else if cpuTopology != "" {
+		topology, err := vmconfig.ParseCPUTopology(cpuTopology)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSet, err)
+		}
+
+		cpuOptions.Topology = topology
+	}
+
+	if len(cpuAffinity) != 0 {
+		cpuOptions.Affinity = nil
+
+		for _, rawAffinity := range cpuAffinity {
+			if rawAffinity == "none" {
+				continue
+			}
+
+			affinity, err := vmconfig.ParseCPUAffinity(rawAffinity)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSet, err)
+			}
+
+			cpuOptions.Affinity = append(cpuOptions.Affinity, affinity)
+		}
+	}
+
+	if cmd.Flags().Changed("memory-shared") {
+		memoryOptions.Shared = memoryShared
+	}
+
+	if cmd.Flags().Changed("memory-hugepages") {
+		memoryOptions.Hugepages = memoryHugepages
+	}
+
+	if memoryHotplugSize != "" {
+		hotplugSize, err := humanize.ParseBytes(memoryHotplugSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse memory hotplug size %q: %v", ErrSet, memoryHotplugSize, err)
+		}
+
+		memoryOptions.HotplugSize = hotplugSize
+	}
+
+	if memoryHotplugMethod == "default" {
+		memoryOptions.HotplugMethod = ""
+	} else if memoryHotplugMethod != "" {
+		memoryOptions.HotplugMethod = vmconfig.HotplugMethod(memoryHotplugMethod)
+	}
+
+	if memoryHugepageSize == "default" {
+		memoryOptions.HugepageSize = 0
+	} else if memoryHugepageSize != "" {
+		hugepageSize, err := humanize.ParseBytes(memoryHugepageSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse huge page size %q: %v", ErrSet, memoryHugepageSize, err)
+		}
+
+		memoryOptions.HugepageSize = hugepageSize
+	}
+
+	if len(numaNodes) != 0 {
+		vmConfig.NUMANodes = nil
+
+		for _, rawNUMANode := range numaNodes {
+			if rawNUMANode == "none" {
+				continue
+			}
+
+			numaNode, err := vmconfig.ParseNUMANode(rawNUMANode)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSet, err)
+			}
+
+			vmConfig.NUMANodes = append(vmConfig.NUMANodes, numaNode)
+		}
+	}
+
+	// Omit the options from the VM's configuration when they are all reset
+	vmConfig.CPU = nil
+	if !cpuOptions.IsEmpty() {
+		vmConfig.CPU = &cpuOptions
+	}
+
+	vmConfig.Memory = nil
+	if !memoryOptions.IsEmpty() {
+		vmConfig.Memory = &memoryOptions
+	}
+
+	return nil
+}
+
+func setBalloonOptions(cmd *cobra.Command, vmConfig *vmconfig.VMConfig) error {
+	switch balloon {
+	case "":
+		// not changed
+	case "none":
+		vmConfig.Balloon = nil
+	default:
+		balloonSize, err := humanize.ParseBytes(balloon)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse balloon size %q: %v", ErrSet, balloon, err)
+		}
+
+		if vmConfig.Balloon == nil {
+			vmConfig.Balloon = &vmconfig.Balloon{}
+		}
+
+		vmConfig.Balloon.Size = balloonSize
+	}
+
+	for _, flag := range []lo.Tuple2[string, func(balloon *vmconfig.Balloon)]{
+		lo.T2("balloon-deflate-on-oom", func(balloon *vmconfig.Balloon) {
+			balloon.DeflateOnOOM = balloonDeflateOnOOM
+		}),
+		lo.T2("balloon-free-page-reporting", func(balloon *vmconfig.Balloon) {
+			balloon.FreePageReporting = balloonFreePageReporting
+		}),
+	} {
+		if !cmd.Flags().Changed(flag.A) {
+			continue
+		}
+
+		if vmConfig.Balloon == nil {
+			return fmt.Errorf("%w: --%s requires a memory balloon device, add it using --balloon", ErrSet, flag.A)
+		}
+
+		flag.B(vmConfig.Balloon)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name"
+	"github.com/cirruslabs/vetu/internal/name/localname"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/storage/local"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/spf13/cobra"
+)
+
+var ErrVerificationFailed = errors.New("VM verification failed")
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify NAME",
+		Short: "Verify VM's disks against the digests recorded when pulling",
+		Long: "Verify VM's disks against the digests recorded when pulling. Local VMs " +
+			"cloned from a remote VM are verified too, but note that their disks are " +
+			"expected to change once they are run.",
+		RunE: runVerify,
+		Args: cobra.ExactArgs(1),
+	}
+
+	return cmd
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	vmName, err := name.NewFromString(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Open and lock VM directory (under a global lock) until the end of the "vetu verify" execution
+	vmDir, err := globallock.With(cmd.Context(), func() (*vmdirectory.VMDirectory, error) {
+		var vmDir *vmdirectory.VMDirectory
+
+		switch typedName := vmName.(type) {
+		case localname.LocalName:
+			vmDir, err = local.Open(typedName)
+		case remotename.RemoteName:
+			vmDir, err = remote.Open(typedName)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockShared)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lock.Trylock(); err != nil {
+			return nil, err
+		}
+
+		return vmDir, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	diskLayers, err := vmDir.DiskLayers()
+	if err != nil {
+		return err
+	}
+
+	if len(diskLayers) == 0 {
+		return fmt.Errorf("VM %s has no disk digests recorded, it was either created locally "+
+			"or pulled by an older Vetu version", vmName)
+	}
+
+	fmt.Printf("verifying %d disk layer(s)...\n", len(diskLayers))
+
+	var failed int
+
+	for _, diskLayer := range diskLayers {
+		actualDigest, err := vmDir.DiskLayerDigest(diskLayer)
+		if err != nil {
+			return err
+		}
+
+		if actualDigest != diskLayer.Digest {
+			fmt.Printf("disk %s at offset %d (%d bytes) has digest %s, expected %s\n",
+				diskLayer.Disk, diskLayer.Offset, diskLayer.Size, actualDigest, diskLayer.Digest)
+
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%w: %d of %d disk layer(s) don't match", ErrVerificationFailed,
+			failed, len(diskLayers))
+	}
+
+	fmt.Println("all disk layers match")
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package diskusage calculates the disk space occupied by the VMs, taking into account
+// the sparse files and the extents shared between the files (e.g. when cloned using reflinks).
+package diskusage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cirruslabs/vetu/internal/fiemap"
+	"golang.org/x/sys/unix"
+)
+
+type Usage struct {
+	// Apparent is the sum of the file sizes
+	Apparent uint64 `json:"apparentSize"`
+
+	// Allocated is the space occupied on disk, with
+	// the shared extents only being counted once
+	Allocated uint64 `json:"allocatedSize"`
+
+	// Shared is the part of Allocated that consists
+	// of the extents shared between the files
+	Shared uint64 `json:"sharedSize"`
+}
+
+// Counter accumulates the disk usage of multiple files
+// and directories, counting each shared extent only once.
+type Counter struct {
+	apparent  uint64
+	exclusive uint64
+	shared    map[uint64][]span
+}
+
+type span struct {
+	start uint64
+	end   uint64
+}
+
+func New() *Counter {
+	return &Counter{
+		shared: map[uint64][]span{},
+	}
+}
+
+// Of is a shorthand for calculating the disk usage of a single directory.
+func Of(path string) (Usage, error) {
+	counter := New()
+
+	if err := counter.AddDir(path); err != nil {
+		return Usage{}, err
+	}
+
+	return counter.Usage(), nil
+}
+
+func (counter *Counter) AddDir(path string) error {
+	return filepath.WalkDir(path, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return counter.AddFile(path)
+	})
+}
+
+func (counter *Counter) AddFile(path string) error {
+	var stat unix.Stat_t
+
+	if err := unix.Lstat(path, &stat); err != nil {
+		return err
+	}
+
+	// st_blocks is always expressed in 512-byte units
+	allocated := uint64(stat.Blocks) * 512
+
+	counter.apparent += uint64(stat.Size)
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFREG || allocated == 0 {
+		counter.exclusive += allocated
+
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	extents, err := fiemap.Extents(file)
+	if err != nil {
+		// Simply count all the allocated blocks
+		// on file systems that don't support FIEMAP
+		if errors.Is(err, fiemap.ErrUnsupported) {
+			counter.exclusive += allocated
+
+			return nil
+		}
+
+		return err
+	}
+
+	//nolint:unconvert // st_dev's type differs between the platforms
+	dev := uint64(stat.Dev)
+
+	var shared uint64
+
+	for _, extent := range extents {
+		// Physical offset is meaningless for the extents with unknown location
+		if extent.Flags&fiemap.FlagShared == 0 || extent.Flags&fiemap.FlagUnknown != 0 {
+			continue
+		}
+
+		counter.shared[dev] = append(counter.shared[dev], span{
+			start: extent.Physical,
+			end:   extent.Physical + extent.Length,
+		})
+
+		shared += extent.Length
+	}
+
+	counter.exclusive += allocated - min(shared, allocated)
+
+	return nil
+}
+
+func (counter *Counter) Usage() Usage {
+	var shared uint64
+
+	for _, spans := range counter.shared {
+		shared += unionLength(spans)
+	}
+
+	return Usage{
+		Apparent:  counter.apparent,
+		Allocated: counter.exclusive + shared,
+		Shared:    shared,
+	}
+}
+
+func unionLength(spans []span) uint64 {
+	sorted := make([]span, len(spans))
+	copy(sorted, spans)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	var result uint64
+
+	var current span
+
+	for i, span := range sorted {
+		if i == 0 {
+			current = span
+
+			continue
+		}
+
+		if span.start <= current.end {
+			current.end = max(current.end, span.end)
+
+			continue
+		}
+
+		result += current.end - current.start
+		current = span
+	}
+
+	if len(sorted) != 0 {
+		result += current.end - current.start
+	}
+
+	return result
+}
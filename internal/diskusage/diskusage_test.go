@@ -0,0 +1,33 @@
+package diskusage_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/diskusage"
+	"github.com/dustin/go-humanize"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparse(t *testing.T) {
+	dir := t.TempDir()
+
+	// Create a 64 MB sparse file with only 1 MB of data in the middle
+	file, err := os.Create(filepath.Join(dir, "disk.img"))
+	require.NoError(t, err)
+
+	require.NoError(t, file.Truncate(64*humanize.MiByte))
+
+	_, err = file.WriteAt(make([]byte, humanize.MiByte), 32*humanize.MiByte)
+	require.NoError(t, err)
+	require.NoError(t, file.Sync())
+	require.NoError(t, file.Close())
+
+	usage, err := diskusage.Of(dir)
+	require.NoError(t, err)
+
+	require.GreaterOrEqual(t, usage.Apparent, uint64(64*humanize.MiByte))
+	require.GreaterOrEqual(t, usage.Allocated, uint64(humanize.MiByte))
+	require.Less(t, usage.Allocated, uint64(2*humanize.MiByte))
+	require.Zero(t, usage.Shared)
+}
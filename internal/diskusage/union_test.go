@@ -0,0 +1,20 @@
+package diskusage
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUnionLength(t *testing.T) {
+	require.Zero(t, unionLength(nil))
+
+	// Overlapping, adjacent, duplicate and disjoint spans
+	require.EqualValues(t, 40, unionLength([]span{
+		{start: 30, end: 40},
+		{start: 0, end: 10},
+		{start: 5, end: 15},
+		{start: 15, end: 20},
+		{start: 30, end: 40},
+		{start: 50, end: 60},
+	}))
+}
@@ -6,7 +6,19 @@ import (
 	"github.com/samber/lo"
 )
 
-func Load(reference ref.Ref, insecure bool) ([]config.Host, error) {
+// Load loads hosts from the Docker configuration file, additional references
+// can be specified to disable TLS for their registries too when insecure is true.
+func Load(reference ref.Ref, insecure bool, additionalReferences ...ref.Ref) ([]config.Host, error) {
+	references := append([]ref.Ref{reference}, additionalReferences...)
+
+	// Local OCI image-layout directories need no host configuration
+	references = lo.Filter(references, func(reference ref.Ref, index int) bool {
+		return reference.Scheme != "ocidir"
+	})
+	if len(references) == 0 {
+		return nil, nil
+	}
+
 	hosts, err := config.DockerLoad()
 	if err != nil {
 		return nil, err
@@ -21,16 +33,18 @@ func Load(reference ref.Ref, insecure bool) ([]config.Host, error) {
 		})
 
 		// Work around github.com/regclient/regclient not having a WithDefaultTLS(...) option
-		// by providing a TLS field override for the registry associated with the passed
-		// reference.
+		// by providing a TLS field override for the registries associated with the passed
+		// references.
 		//
 		// This means that if the user wants to pull or push from 127.0.0.1:8080/a/b:latest
 		// insecurely and Docker configuration contains no such registry, we'll effectively
 		// force the regclient to disable TLS for that registry.
-		hosts = append(hosts, config.Host{
-			Name: reference.Registry,
-			TLS:  config.TLSDisabled,
-		})
+		for _, reference := range references {
+			hosts = append(hosts, config.Host{
+				Name: reference.Registry,
+				TLS:  config.TLSDisabled,
+			})
+		}
 	}
 
 	return hosts, nil
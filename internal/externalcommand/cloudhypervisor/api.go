@@ -0,0 +1,200 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var ErrAPI = errors.New("Cloud Hypervisor API request failed")
+
+// APIClient talks to the Cloud Hypervisor's REST API[1] over the UNIX socket
+// specified in the "--api-socket" argument.
+//
+// [1]: https://github.com/cloud-hypervisor/cloud-hypervisor/blob/main/docs/api.md
+type APIClient struct {
+	httpClient *http.Client
+}
+
+type PingResponse struct {
+	BuildVersion string `json:"build_version"`
+	Version      string `json:"version"`
+	PID          int32  `json:"pid"`
+}
+
+type InfoResponse struct {
+	State            string     `json:"state"`
+	Config           InfoConfig `json:"config"`
+	MemoryActualSize uint64     `json:"memory_actual_size"`
+}
+
+// InfoConfig is the subset of the running VM's
+// configuration, which reflects the changes made by vm.resize.
+type InfoConfig struct {
+	CPUs   InfoCPUs   `json:"cpus"`
+	Memory InfoMemory `json:"memory"`
+}
+
+type InfoCPUs struct {
+	BootVCPUs uint16 `json:"boot_vcpus"`
+	MaxVCPUs  uint16 `json:"max_vcpus"`
+}
+
+type InfoMemory struct {
+	Size           uint64 `json:"size"`
+	HotplugSize    uint64 `json:"hotplug_size"`
+	HotpluggedSize uint64 `json:"hotplugged_size"`
+	HotplugMethod  string `json:"hotplug_method"`
+}
+
+// CurrentSize returns the amount of memory currently
+// plugged into the VM, including the hotplugged memory.
+func (memory *InfoMemory) CurrentSize() uint64 {
+	return memory.Size + memory.HotpluggedSize
+}
+
+type ResizeRequest struct {
+	DesiredVCPUs   *uint16 `json:"desired_vcpus,omitempty"`
+	DesiredRAM     *uint64 `json:"desired_ram,omitempty"`
+	DesiredBalloon *uint64 `json:"desired_balloon,omitempty"`
+}
+
+type AddDiskRequest struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+	ID       string `json:"id,omitempty"`
+}
+
+type AddDeviceRequest struct {
+	Path       string `json:"path"`
+	IOMMU      bool   `json:"iommu,omitempty"`
+	PCISegment uint16 `json:"pci_segment,omitempty"`
+	ID         string `json:"id,omitempty"`
+}
+
+// PCIDeviceInfo describes the hotplugged device.
+type PCIDeviceInfo struct {
+	ID  string `json:"id"`
+	BDF string `json:"bdf"`
+}
+
+type RemoveDeviceRequest struct {
+	ID string `json:"id"`
+}
+
+func NewAPIClient(socketPath string) *APIClient {
+	return &APIClient{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+func (client *APIClient) Ping(ctx context.Context) (*PingResponse, error) {
+	var response PingResponse
+
+	if err := client.do(ctx, http.MethodGet, "vmm.ping", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (client *APIClient) Info(ctx context.Context) (*InfoResponse, error) {
+	var response InfoResponse
+
+	if err := client.do(ctx, http.MethodGet, "vm.info", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (client *APIClient) Resize(ctx context.Context, request ResizeRequest) error {
+	return client.do(ctx, http.MethodPut, "vm.resize", request, nil)
+}
+
+func (client *APIClient) AddDisk(ctx context.Context, request AddDiskRequest) (*PCIDeviceInfo, error) {
+	var response PCIDeviceInfo
+
+	if err := client.do(ctx, http.MethodPut, "vm.add-disk", request, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (client *APIClient) AddDevice(ctx context.Context, request AddDeviceRequest) (*PCIDeviceInfo, error) {
+	var response PCIDeviceInfo
+
+	if err := client.do(ctx, http.MethodPut, "vm.add-device", request, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (client *APIClient) RemoveDevice(ctx context.Context, request RemoveDeviceRequest) error {
+	return client.do(ctx, http.MethodPut, "vm.remove-device", request, nil)
+}
+
+func (client *APIClient) do(ctx context.Context, method string, endpoint string, request any, response any) error {
+	var body io.Reader
+
+	if request != nil {
+		requestBytes, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(requestBytes)
+	}
+
+	// The host is ignored since we always connect to the UNIX socket
+	httpRequest, err := http.NewRequestWithContext(ctx, method, "http://localhost/api/v1/"+endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	if request != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResponse, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrAPI, endpoint, err)
+	}
+	defer httpResponse.Body.Close()
+
+	responseBytes, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrAPI, endpoint, err)
+	}
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s: %s: %s", ErrAPI, endpoint, httpResponse.Status,
+			strings.TrimSpace(string(responseBytes)))
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(responseBytes, response); err != nil {
+		return fmt.Errorf("%w: %s: failed to parse the response: %v", ErrAPI, endpoint, err)
+	}
+
+	return nil
+}
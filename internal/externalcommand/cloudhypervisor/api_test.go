@@ -0,0 +1,112 @@
+package cloudhypervisor_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIClient(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "api.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var resizeRequest map[string]any
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/vmm.ping", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"build_version":"v48.0","version":"48.0","pid":1234}`))
+	})
+	mux.HandleFunc("GET /api/v1/vm.info", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"state":"Running","config":{"cpus":{"boot_vcpus":2,"max_vcpus":4},` +
+			`"memory":{"size":2147483648,"hotplug_size":4294967296,"hotplugged_size":1073741824,` +
+			`"hotplug_method":"VirtioMem"}},"memory_actual_size":2147483648}`))
+	})
+	mux.HandleFunc("PUT /api/v1/vm.resize", func(writer http.ResponseWriter, request *http.Request) {
+		requestBytes, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		resizeRequest = nil
+		require.NoError(t, json.Unmarshal(requestBytes, &resizeRequest))
+
+		if _, ok := resizeRequest["desired_balloon"]; !ok {
+			http.Error(writer, "Error resizing VM: InvalidResizeRequest", http.StatusInternalServerError)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("PUT /api/v1/vm.add-disk", func(writer http.ResponseWriter, request *http.Request) {
+		var addDiskRequest map[string]any
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&addDiskRequest))
+		require.Equal(t, map[string]any{"path": "/tmp/scratch.img", "readonly": true}, addDiskRequest)
+
+		_, _ = writer.Write([]byte(`{"id":"_disk2","bdf":"0000:00:06.0"}`))
+	})
+	mux.HandleFunc("PUT /api/v1/vm.remove-device", func(writer http.ResponseWriter, request *http.Request) {
+		var removeDeviceRequest map[string]any
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&removeDeviceRequest))
+		require.Equal(t, map[string]any{"id": "_disk2"}, removeDeviceRequest)
+
+		writer.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	api := cloudhypervisor.NewAPIClient(socketPath)
+
+	ping, err := api.Ping(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, 1234, ping.PID)
+
+	info, err := api.Info(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "Running", info.State)
+	require.EqualValues(t, 2147483648, info.MemoryActualSize)
+	require.EqualValues(t, 4, info.Config.CPUs.MaxVCPUs)
+	require.EqualValues(t, 3221225472, info.Config.Memory.CurrentSize())
+
+	// Zero balloon size should be sent, whereas the unset fields should be omitted
+	var balloonSize uint64
+
+	require.NoError(t, api.Resize(context.Background(), cloudhypervisor.ResizeRequest{
+		DesiredBalloon: &balloonSize,
+	}))
+	require.Equal(t, map[string]any{"desired_balloon": float64(0)}, resizeRequest)
+
+	// Errors should include the Cloud Hypervisor's response
+	err = api.Resize(context.Background(), cloudhypervisor.ResizeRequest{})
+	require.ErrorIs(t, err, cloudhypervisor.ErrAPI)
+	require.ErrorContains(t, err, "vm.resize: 500 Internal Server Error: Error resizing VM: InvalidResizeRequest")
+
+	// Hotplugged devices should be identified by the Cloud Hypervisor's response
+	deviceInfo, err := api.AddDisk(context.Background(), cloudhypervisor.AddDiskRequest{
+		Path:     "/tmp/scratch.img",
+		Readonly: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, &cloudhypervisor.PCIDeviceInfo{ID: "_disk2", BDF: "0000:00:06.0"}, deviceInfo)
+
+	require.NoError(t, api.RemoveDevice(context.Background(), cloudhypervisor.RemoveDeviceRequest{
+		ID: deviceInfo.ID,
+	}))
+
+	_, err = cloudhypervisor.NewAPIClient(filepath.Join(t.TempDir(), "missing.sock")).Ping(context.Background())
+	require.ErrorIs(t, err, cloudhypervisor.ErrAPI)
+}
@@ -0,0 +1,21 @@
+// Package fiemap retrieves the physical layout of the file's data
+// using the FIEMAP ioctl(2), which allows to tell which parts of the
+// file are shared with other files (e.g. when cloned using reflinks).
+package fiemap
+
+import "errors"
+
+var ErrUnsupported = errors.New("FIEMAP is not supported")
+
+const (
+	FlagLast    = 0x00000001
+	FlagUnknown = 0x00000002
+	FlagShared  = 0x00002000
+)
+
+type Extent struct {
+	Logical  uint64
+	Physical uint64
+	Length   uint64
+	Flags    uint32
+}
@@ -0,0 +1,76 @@
+package fiemap
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// _IOWR('f', 11, struct fiemap)
+const fsIocFiemap = 0xC020660B
+
+const extentsPerRequest = 128
+
+// See struct fiemap and struct fiemap_extent in linux/fiemap.h
+type request struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	Reserved      uint32
+	Extents       [extentsPerRequest]extent
+}
+
+type extent struct {
+	Logical    uint64
+	Physical   uint64
+	Length     uint64
+	Reserved64 [2]uint64
+	Flags      uint32
+	Reserved   [3]uint32
+}
+
+func Extents(file *os.File) ([]Extent, error) {
+	var result []Extent
+
+	var start uint64
+
+	for {
+		req := request{
+			Start:       start,
+			Length:      ^uint64(0) - start,
+			ExtentCount: extentsPerRequest,
+		}
+
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&req)))
+		if errno != 0 {
+			if errors.Is(errno, unix.EOPNOTSUPP) || errors.Is(errno, unix.ENOTTY) {
+				return nil, ErrUnsupported
+			}
+
+			return nil, errno
+		}
+
+		if req.MappedExtents == 0 {
+			return result, nil
+		}
+
+		for _, extent := range req.Extents[:req.MappedExtents] {
+			result = append(result, Extent{
+				Logical:  extent.Logical,
+				Physical: extent.Physical,
+				Length:   extent.Length,
+				Flags:    extent.Flags,
+			})
+
+			if extent.Flags&FlagLast != 0 {
+				return result, nil
+			}
+
+			start = extent.Logical + extent.Length
+		}
+	}
+}
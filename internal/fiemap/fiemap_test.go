@@ -0,0 +1,65 @@
+package fiemap_test
+
+import (
+	"errors"
+	"github.com/cirruslabs/vetu/internal/fiemap"
+	"github.com/dustin/go-humanize"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtents(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	// Write 1 MB of data at 32 MB offset of a 64 MB sparse file
+	require.NoError(t, file.Truncate(64*humanize.MiByte))
+
+	_, err = file.WriteAt(make([]byte, humanize.MiByte), 32*humanize.MiByte)
+	require.NoError(t, err)
+	require.NoError(t, file.Sync())
+
+	extents, err := fiemap.Extents(file)
+	if errors.Is(err, fiemap.ErrUnsupported) {
+		t.Skip("FIEMAP is not supported on this file system")
+	}
+	require.NoError(t, err)
+	require.NotEmpty(t, extents)
+
+	var length uint64
+
+	for _, extent := range extents {
+		require.GreaterOrEqual(t, extent.Logical, uint64(32*humanize.MiByte))
+		require.Zero(t, extent.Flags&fiemap.FlagShared)
+
+		length += extent.Length
+	}
+
+	require.EqualValues(t, humanize.MiByte, length)
+	require.NotZero(t, extents[len(extents)-1].Flags&fiemap.FlagLast)
+}
+
+func TestExtentsMoreThanFitInOneRequest(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	// Write 300 chunks of data separated by holes
+	const numChunks = 300
+
+	for i := range numChunks {
+		_, err = file.WriteAt(make([]byte, 4096), int64(i)*64*humanize.KiByte)
+		require.NoError(t, err)
+	}
+	require.NoError(t, file.Sync())
+
+	extents, err := fiemap.Extents(file)
+	if errors.Is(err, fiemap.ErrUnsupported) {
+		t.Skip("FIEMAP is not supported on this file system")
+	}
+	require.NoError(t, err)
+	require.Len(t, extents, numChunks)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fiemap
+
+import "os"
+
+func Extents(file *os.File) ([]Extent, error) {
+	return nil, ErrUnsupported
+}
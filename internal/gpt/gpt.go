@@ -0,0 +1,285 @@
+// Package gpt reads the GUID Partition Table (GPT) of a disk image and
+// relocates its backup copy to the end of the disk when the disk is resized.
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"unicode/utf16"
+)
+
+var (
+	ErrNotFound = errors.New("no GPT partition table found")
+	ErrInvalid  = errors.New("invalid GPT partition table")
+)
+
+var signature = [8]byte{'E', 'F', 'I', ' ', 'P', 'A', 'R', 'T'}
+
+// sectorSizes are the logical sector sizes we probe for the GPT header,
+// which is always located at LBA 1
+var sectorSizes = []int64{512, 4096}
+
+const (
+	headerSize       = 92
+	minEntrySize     = 128
+	maxEntriesSize   = 1024 * 1024
+	protectiveMBRKey = 0xEE
+)
+
+type header struct {
+	Signature           [8]byte
+	Revision            uint32
+	HeaderSize          uint32
+	HeaderCRC32         uint32
+	Reserved            uint32
+	CurrentLBA          uint64
+	BackupLBA           uint64
+	FirstUsableLBA      uint64
+	LastUsableLBA       uint64
+	DiskGUID            [16]byte
+	PartitionEntryLBA   uint64
+	NumPartitionEntries uint32
+	PartitionEntrySize  uint32
+	PartitionEntryCRC32 uint32
+}
+
+type entry struct {
+	TypeGUID   [16]byte
+	UniqueGUID [16]byte
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       [36]uint16
+}
+
+type ReaderWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+type Partition struct {
+	Number   int
+	Name     string
+	FirstLBA uint64
+	LastLBA  uint64
+}
+
+type Table struct {
+	SectorSize int64
+	Partitions []Partition
+
+	header  header
+	entries []byte
+}
+
+// Read reads and validates the primary GPT of the disk.
+func Read(disk io.ReaderAt) (*Table, error) {
+	for _, sectorSize := range sectorSizes {
+		headerBytes := make([]byte, sectorSize)
+
+		if _, err := disk.ReadAt(headerBytes, sectorSize); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, err
+		}
+
+		if !bytes.HasPrefix(headerBytes, signature[:]) {
+			continue
+		}
+
+		return read(disk, sectorSize, headerBytes)
+	}
+
+	return nil, ErrNotFound
+}
+
+func read(disk io.ReaderAt, sectorSize int64, headerBytes []byte) (*Table, error) {
+	table := &Table{
+		SectorSize: sectorSize,
+	}
+
+	if err := binary.Read(bytes.NewReader(headerBytes), binary.LittleEndian, &table.header); err != nil {
+		return nil, err
+	}
+
+	if table.header.HeaderSize < headerSize || int64(table.header.HeaderSize) > sectorSize {
+		return nil, fmt.Errorf("%w: unexpected header size %d", ErrInvalid, table.header.HeaderSize)
+	}
+
+	if headerCRC32(headerBytes[:table.header.HeaderSize]) != table.header.HeaderCRC32 {
+		return nil, fmt.Errorf("%w: header checksum mismatch", ErrInvalid)
+	}
+
+	if table.header.CurrentLBA != 1 {
+		return nil, fmt.Errorf("%w: primary header is located at LBA %d", ErrInvalid, table.header.CurrentLBA)
+	}
+
+	entrySize := table.header.PartitionEntrySize
+	entriesSize := uint64(table.header.NumPartitionEntries) * uint64(entrySize)
+
+	if entrySize < minEntrySize || entriesSize > maxEntriesSize {
+		return nil, fmt.Errorf("%w: unexpected partition entries layout (%d entries of %d bytes)",
+			ErrInvalid, table.header.NumPartitionEntries, entrySize)
+	}
+
+	table.entries = make([]byte, entriesSize)
+
+	if _, err := disk.ReadAt(table.entries, int64(table.header.PartitionEntryLBA)*sectorSize); err != nil {
+		return nil, fmt.Errorf("%w: failed to read partition entries: %v", ErrInvalid, err)
+	}
+
+	if crc32.ChecksumIEEE(table.entries) != table.header.PartitionEntryCRC32 {
+		return nil, fmt.Errorf("%w: partition entries checksum mismatch", ErrInvalid)
+	}
+
+	for i := range int(table.header.NumPartitionEntries) {
+		var entry entry
+
+		entryBytes := table.entries[i*int(entrySize) : i*int(entrySize)+minEntrySize]
+
+		if err := binary.Read(bytes.NewReader(entryBytes), binary.LittleEndian, &entry); err != nil {
+			return nil, err
+		}
+
+		// Unused entries have a zero partition type GUID
+		if entry.TypeGUID == [16]byte{} {
+			continue
+		}
+
+		table.Partitions = append(table.Partitions, Partition{
+			Number:   i + 1,
+			Name:     string(utf16.Decode(trimName(entry.Name))),
+			FirstLBA: entry.FirstLBA,
+			LastLBA:  entry.LastLBA,
+		})
+	}
+
+	return table, nil
+}
+
+// MinimumSize returns the smallest disk size in bytes that fits all the partitions
+// followed by the backup GPT (partition entries and the header).
+func (table *Table) MinimumSize() int64 {
+	lastUsedLBA := table.header.FirstUsableLBA - 1
+
+	for _, partition := range table.Partitions {
+		lastUsedLBA = max(lastUsedLBA, partition.LastLBA)
+	}
+
+	return int64(lastUsedLBA+1+table.entriesSectors()+1) * table.SectorSize
+}
+
+// Resize updates the GPT for the disk of the specified size by writing
+// the backup GPT at the end of the disk and updating the primary GPT
+// and the protective MBR to reference it, the disk itself is not resized.
+func (table *Table) Resize(disk ReaderWriterAt, size int64) error {
+	if size%table.SectorSize != 0 {
+		return fmt.Errorf("%w: disk size %d is not a multiple of the sector size %d",
+			ErrInvalid, size, table.SectorSize)
+	}
+
+	if size < table.MinimumSize() {
+		return fmt.Errorf("%w: disk size %d is too small to fit the partitions", ErrInvalid, size)
+	}
+
+	lastLBA := uint64(size/table.SectorSize) - 1
+
+	table.header.BackupLBA = lastLBA
+	table.header.LastUsableLBA = lastLBA - table.entriesSectors() - 1
+	table.header.PartitionEntryCRC32 = crc32.ChecksumIEEE(table.entries)
+
+	// Write the backup GPT first, so that the primary GPT
+	// never references a backup GPT that doesn't exist
+	backupHeader := table.header
+	backupHeader.CurrentLBA = lastLBA
+	backupHeader.BackupLBA = 1
+	backupHeader.PartitionEntryLBA = table.header.LastUsableLBA + 1
+
+	if err := table.write(disk, backupHeader); err != nil {
+		return err
+	}
+
+	if err := table.write(disk, table.header); err != nil {
+		return err
+	}
+
+	return table.updateProtectiveMBR(disk, lastLBA)
+}
+
+func (table *Table) write(disk io.WriterAt, header header) error {
+	if _, err := disk.WriteAt(table.entries, int64(header.PartitionEntryLBA)*table.SectorSize); err != nil {
+		return err
+	}
+
+	headerBuf := &bytes.Buffer{}
+
+	header.HeaderCRC32 = 0
+
+	if err := binary.Write(headerBuf, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	// The rest of the header (if any) is reserved and must be zero
+	headerBytes := make([]byte, header.HeaderSize)
+	copy(headerBytes, headerBuf.Bytes())
+
+	binary.LittleEndian.PutUint32(headerBytes[16:20], headerCRC32(headerBytes))
+
+	_, err := disk.WriteAt(headerBytes, int64(header.CurrentLBA)*table.SectorSize)
+
+	return err
+}
+
+// updateProtectiveMBR updates the size of the protective MBR's partition,
+// which is supposed to cover the whole disk (or as much of it as possible).
+func (table *Table) updateProtectiveMBR(disk ReaderWriterAt, lastLBA uint64) error {
+	// First MBR partition record starts at offset 446
+	partitionRecord := make([]byte, 16)
+
+	if _, err := disk.ReadAt(partitionRecord, 446); err != nil {
+		return err
+	}
+
+	if partitionRecord[4] != protectiveMBRKey {
+		return nil
+	}
+
+	binary.LittleEndian.PutUint32(partitionRecord[12:16], uint32(min(lastLBA, 0xFFFFFFFF)))
+
+	_, err := disk.WriteAt(partitionRecord, 446)
+
+	return err
+}
+
+func (table *Table) entriesSectors() uint64 {
+	sectorSize := uint64(table.SectorSize)
+
+	return (uint64(len(table.entries)) + sectorSize - 1) / sectorSize
+}
+
+// headerCRC32 calculates the header checksum, which
+// assumes the header checksum field to be zero.
+func headerCRC32(headerBytes []byte) uint32 {
+	withoutCRC32 := bytes.Clone(headerBytes)
+
+	binary.LittleEndian.PutUint32(withoutCRC32[16:20], 0)
+
+	return crc32.ChecksumIEEE(withoutCRC32)
+}
+
+// trimName strips the NUL padding from the UTF-16 partition name.
+func trimName(name [36]uint16) []uint16 {
+	result := name[:]
+
+	for len(result) != 0 && result[len(result)-1] == 0 {
+		result = result[:len(result)-1]
+	}
+
+	return result
+}
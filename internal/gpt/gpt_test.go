@@ -0,0 +1,152 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+)
+
+const mib = 1024 * 1024
+
+func TestReadAndResize(t *testing.T) {
+	disk := newDisk(t, 64*mib, []entry{
+		newEntry("boot", 2048, 32*1024-1),
+		newEntry("root", 32*1024, 64*1024-1),
+	})
+
+	table, err := Read(disk)
+	require.NoError(t, err)
+	require.EqualValues(t, 512, table.SectorSize)
+	require.Equal(t, []Partition{
+		{Number: 1, Name: "boot", FirstLBA: 2048, LastLBA: 32*1024 - 1},
+		{Number: 2, Name: "root", FirstLBA: 32 * 1024, LastLBA: 64*1024 - 1},
+	}, table.Partitions)
+
+	// Partitions end at 32 MiB, followed by 32 sectors
+	// of the partition entries and a sector of the header
+	require.EqualValues(t, 32*mib+33*512, table.MinimumSize())
+
+	// Shrinking below the end of the last partition should fail
+	require.ErrorIs(t, table.Resize(disk, 32*mib), ErrInvalid)
+
+	// Shrinking to fit the partitions should relocate the backup GPT
+	require.NoError(t, table.Resize(disk, 33*mib))
+	require.NoError(t, disk.Truncate(33*mib))
+
+	table, err = Read(disk)
+	require.NoError(t, err)
+	require.Len(t, table.Partitions, 2)
+	require.EqualValues(t, 33*mib/512-1, table.header.BackupLBA)
+	require.EqualValues(t, 33*mib/512-34, table.header.LastUsableLBA)
+
+	backupHeaderBytes := make([]byte, 512)
+	_, err = disk.ReadAt(backupHeaderBytes, 33*mib-512)
+	require.NoError(t, err)
+
+	var backupHeader header
+	require.NoError(t, binary.Read(bytes.NewReader(backupHeaderBytes), binary.LittleEndian, &backupHeader))
+	require.Equal(t, signature, backupHeader.Signature)
+	require.EqualValues(t, 33*mib/512-1, backupHeader.CurrentLBA)
+	require.EqualValues(t, 1, backupHeader.BackupLBA)
+	require.EqualValues(t, 33*mib/512-33, backupHeader.PartitionEntryLBA)
+	require.Equal(t, headerCRC32(backupHeaderBytes[:headerSize]), backupHeader.HeaderCRC32)
+
+	// Protective MBR should cover the whole disk
+	partitionRecord := make([]byte, 16)
+	_, err = disk.ReadAt(partitionRecord, 446)
+	require.NoError(t, err)
+	require.EqualValues(t, 33*mib/512-1, binary.LittleEndian.Uint32(partitionRecord[12:16]))
+}
+
+func TestReadNotFound(t *testing.T) {
+	disk, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	defer disk.Close()
+
+	require.NoError(t, disk.Truncate(mib))
+
+	_, err = Read(disk)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReadCorrupted(t *testing.T) {
+	disk := newDisk(t, 8*mib, []entry{
+		newEntry("root", 2048, 4096),
+	})
+
+	// Corrupt the first partition entry
+	_, err := disk.WriteAt([]byte{0xFF}, 2*512+32)
+	require.NoError(t, err)
+
+	_, err = Read(disk)
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func newDisk(t *testing.T, size int64, entries []entry) *os.File {
+	disk, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = disk.Close()
+	})
+
+	require.NoError(t, disk.Truncate(size))
+
+	// Protective MBR
+	mbr := make([]byte, 512)
+	mbr[446+4] = protectiveMBRKey
+	binary.LittleEndian.PutUint32(mbr[446+8:446+12], 1)
+	mbr[510], mbr[511] = 0x55, 0xAA
+
+	_, err = disk.WriteAt(mbr, 0)
+	require.NoError(t, err)
+
+	entriesBuf := &bytes.Buffer{}
+
+	for i := range 128 {
+		var entry entry
+
+		if i < len(entries) {
+			entry = entries[i]
+		}
+
+		require.NoError(t, binary.Write(entriesBuf, binary.LittleEndian, entry))
+	}
+
+	table := &Table{
+		SectorSize: 512,
+		header: header{
+			Signature:           signature,
+			Revision:            0x00010000,
+			HeaderSize:          headerSize,
+			CurrentLBA:          1,
+			FirstUsableLBA:      34,
+			PartitionEntryLBA:   2,
+			NumPartitionEntries: 128,
+			PartitionEntrySize:  minEntrySize,
+		},
+		entries: entriesBuf.Bytes(),
+	}
+
+	require.NoError(t, table.Resize(disk, size))
+
+	return disk
+}
+
+func newEntry(name string, firstLBA uint64, lastLBA uint64) entry {
+	entry := entry{
+		// Linux filesystem data
+		TypeGUID: [16]byte{0xAF, 0x3D, 0xC6, 0x0F, 0x83, 0x84, 0x72, 0x47,
+			0x8E, 0x79, 0x3D, 0x69, 0xD8, 0x47, 0x7D, 0xE4},
+		FirstLBA: firstLBA,
+		LastLBA:  lastLBA,
+	}
+
+	copy(entry.Name[:], utf16.Encode([]rune(name)))
+
+	return entry
+}
@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -65,6 +66,86 @@ func TestPushPull(t *testing.T) {
 	require.Equal(t, originalVMFilesDigests, pulledVMFilesDigests)
 }
 
+// TestPushPullOCIDir ensures that we can push and pull VMs
+// to and from local OCI image-layout directories without
+// the need for a container registry.
+func TestPushPullOCIDir(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create a dummy kernel file that we'll use for creating a VM
+	kernelPath := filepath.Join(tempDir, "kernel")
+	fillFileWithRandomBytes(t, kernelPath, 64*humanize.MByte)
+
+	// Create a dummy disk file that we'll use for creating a VM
+	diskPath := filepath.Join(tempDir, "disk.img")
+	fillFileWithRandomBytes(t, diskPath, 256*humanize.MByte)
+
+	// Create a VM
+	vmName := fmt.Sprintf("integration-test-push-pull-ocidir-%s", uuid.NewString())
+	vmNameRemote := fmt.Sprintf("ocidir://%s:%s", filepath.Join(tempDir, "layout"), uuid.NewString())
+
+	_, _, err := vetu("create", "--kernel", kernelPath, "--disk", diskPath, vmName)
+	require.NoError(t, err)
+
+	originalVMFilesDigests := calculateVMFilesDigests(t, localname.LocalName(vmName))
+
+	// Push the VM to an OCI image layout
+	_, _, err = vetu("push", vmName, vmNameRemote)
+	require.NoError(t, err)
+
+	// Pull the VM from the OCI image layout and make sure
+	// it has the same contents as the VM we've pushed
+	_, _, err = vetu("pull", vmNameRemote)
+	require.NoError(t, err)
+
+	remoteName, err := remotename.NewFromString(vmNameRemote)
+	require.NoError(t, err)
+
+	pulledVMFilesDigests := calculateVMFilesDigests(t, remoteName)
+	require.Equal(t, originalVMFilesDigests, pulledVMFilesDigests)
+}
+
+func TestPushPullAppendToIndex(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create a dummy kernel file that we'll use for creating a VM
+	kernelPath := filepath.Join(tempDir, "kernel")
+	fillFileWithRandomBytes(t, kernelPath, 16*humanize.MByte)
+
+	// Create a dummy disk file that we'll use for creating a VM
+	diskPath := filepath.Join(tempDir, "disk.img")
+	fillFileWithRandomBytes(t, diskPath, 64*humanize.MByte)
+
+	// Create a VM
+	vmName := fmt.Sprintf("integration-test-push-pull-append-to-index-%s", uuid.NewString())
+	vmNameRemote := fmt.Sprintf("ocidir://%s:%s", filepath.Join(tempDir, "layout"), uuid.NewString())
+
+	_, _, err := vetu("create", "--kernel", kernelPath, "--disk", diskPath, vmName)
+	require.NoError(t, err)
+
+	originalVMFilesDigests := calculateVMFilesDigests(t, localname.LocalName(vmName))
+
+	// Push the VM to an OCI image layout twice, the second push
+	// should replace the VM image for the same platform in the index
+	_, _, err = vetu("push", "--append-to-index", vmName, vmNameRemote)
+	require.NoError(t, err)
+
+	_, _, err = vetu("push", "--append-to-index", vmName, vmNameRemote)
+	require.NoError(t, err)
+
+	// Pull the VM from the image index and make sure
+	// it has the same contents as the VM we've pushed
+	stdout, _, err := vetu("pull", vmNameRemote)
+	require.NoError(t, err)
+	require.Contains(t, stdout, "from the image index")
+
+	remoteName, err := remotename.NewFromString(vmNameRemote)
+	require.NoError(t, err)
+
+	pulledVMFilesDigests := calculateVMFilesDigests(t, remoteName)
+	require.Equal(t, originalVMFilesDigests, pulledVMFilesDigests)
+}
+
 func fillFileWithRandomBytes(t *testing.T, path string, sizeBytes int64) {
 	t.Helper()
 
@@ -100,6 +181,12 @@ func calculateVMFilesDigests(t *testing.T, name name.Name) map[string]digest.Dig
 	dirEntries, err := os.ReadDir(vmDir.Path())
 	require.NoError(t, err)
 
+	// Skip the hidden files that Vetu uses for bookkeeping
+	// (e.g. disk layers recorded when pulling)
+	dirEntries = lo.Filter(dirEntries, func(dirEntry os.DirEntry, index int) bool {
+		return !strings.HasPrefix(dirEntry.Name(), ".")
+	})
+
 	return lo.Associate(dirEntries, func(dirEntry os.DirEntry) (string, digest.Digest) {
 		return dirEntry.Name(), calculateFileDigest(t, filepath.Join(vmDir.Path(), dirEntry.Name()))
 	})
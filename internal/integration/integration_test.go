@@ -4,6 +4,7 @@ package integration_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/avast/retry-go/v4"
 	"github.com/google/uuid"
@@ -72,6 +73,70 @@ func TestClone(t *testing.T) {
 	require.Contains(t, stdout, secondVMName)
 }
 
+func TestDisk(t *testing.T) {
+	// Create a dummy kernel file that we'll use for creating a VM
+	kernelPath := filepath.Join(t.TempDir(), "kernel")
+	require.NoError(t, os.WriteFile(kernelPath, []byte(""), 0600))
+
+	vmName := fmt.Sprintf("integration-test-disk-%s", uuid.NewString())
+
+	// Create a VM
+	_, _, err := vetu("create", "--kernel", kernelPath, vmName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _, err = vetu("delete", vmName)
+	})
+
+	// Add two disks and grow one of them
+	_, _, err = vetu("disk", "add", vmName, "--size", "1GiB")
+	require.NoError(t, err)
+
+	_, _, err = vetu("disk", "add", vmName, "data.img", "--size", "1GiB")
+	require.NoError(t, err)
+
+	_, _, err = vetu("disk", "resize", vmName, "data.img", "2GiB")
+	require.NoError(t, err)
+
+	// Shrinking the disk should fail
+	_, _, err = vetu("disk", "resize", vmName, "data.img", "1GiB")
+	require.Error(t, err)
+
+	require.Equal(t, map[string]uint64{
+		"disk1.img": 1024 * 1024 * 1024,
+		"data.img":  2 * 1024 * 1024 * 1024,
+	}, diskSizes(t, vmName))
+
+	// Remove one of the disks
+	_, _, err = vetu("disk", "rm", vmName, "disk1.img")
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]uint64{
+		"data.img": 2 * 1024 * 1024 * 1024,
+	}, diskSizes(t, vmName))
+}
+
+func diskSizes(t *testing.T, vmName string) map[string]uint64 {
+	stdout, _, err := vetu("inspect", "--format", "json", vmName)
+	require.NoError(t, err)
+
+	var info struct {
+		Disks []struct {
+			Name         string `json:"name"`
+			ApparentSize uint64 `json:"apparentSize"`
+		} `json:"disks"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &info))
+
+	result := map[string]uint64{}
+
+	for _, disk := range info.Disks {
+		result[disk.Name] = disk.ApparentSize
+	}
+
+	return result
+}
+
 // TestRunAndSSH ensures that "tart run" correctly starts VMs and
 // that we can connect to these VMs over SSH and issue commands.
 func TestRunAndSSH(t *testing.T) {
@@ -5,9 +5,22 @@ import (
 	"fmt"
 	"github.com/distribution/reference"
 	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types/ref"
+	"path/filepath"
 	"strings"
 )
 
+const (
+	// OCIDirScheme is a prefix for names referring to
+	// local OCI image-layout directories instead of registries
+	OCIDirScheme = "ocidir://"
+
+	// RegistryOCIDir is a pseudo-registry used for names referring
+	// to local OCI image-layout directories, in which case the
+	// Namespace is an absolute path without the leading slash
+	RegistryOCIDir = "ocidir"
+)
+
 var (
 	ErrFailedToParse  = errors.New("failed to parse remote name")
 	ErrNotARemoteName = errors.New("not a remote name")
@@ -21,6 +34,10 @@ type RemoteName struct {
 }
 
 func NewFromString(s string) (RemoteName, error) {
+	if strings.HasPrefix(s, OCIDirScheme) {
+		return newFromOCIDirString(s)
+	}
+
 	named, err := reference.ParseNamed(s)
 	if err != nil {
 		if errors.Is(err, reference.ErrNameNotCanonical) {
@@ -53,8 +70,69 @@ func NewFromString(s string) (RemoteName, error) {
 	return remoteName, nil
 }
 
+func newFromOCIDirString(s string) (RemoteName, error) {
+	parsedRef, err := ref.New(s)
+	if err != nil {
+		return RemoteName{}, fmt.Errorf("%w: %v", ErrFailedToParse, err)
+	}
+
+	// Make the path absolute so that the name refers
+	// to the same OCI image layout regardless of the
+	// current working directory, this also gets rid
+	// of any path traversal components
+	absPath, err := filepath.Abs(parsedRef.Path)
+	if err != nil {
+		return RemoteName{}, fmt.Errorf("%w: %v", ErrFailedToParse, err)
+	}
+
+	remoteName := RemoteName{
+		Registry:  RegistryOCIDir,
+		Namespace: strings.TrimPrefix(absPath, "/"),
+	}
+
+	if remoteName.Namespace == "" {
+		return RemoteName{}, fmt.Errorf("%w: OCI image layout path cannot be the root directory",
+			ErrFailedToParse)
+	}
+
+	switch {
+	case parsedRef.Tag != "" && parsedRef.Digest != "":
+		return RemoteName{}, fmt.Errorf("%w: remote name cannot have both a tag and a digest",
+			ErrFailedToParse)
+	case parsedRef.Tag == "" && parsedRef.Digest == "":
+		remoteName.Tag = "latest"
+	case parsedRef.Tag != "":
+		remoteName.Tag = parsedRef.Tag
+	case parsedRef.Digest != "":
+		parsedDigest, err := digest.Parse(parsedRef.Digest)
+		if err != nil {
+			return RemoteName{}, fmt.Errorf("%w: %v", ErrFailedToParse, err)
+		}
+
+		if parsedDigest.Algorithm() != digest.SHA256 {
+			return RemoteName{}, fmt.Errorf("%w: only %s digests are supported",
+				ErrFailedToParse, digest.SHA256)
+		}
+
+		remoteName.Digest = parsedDigest
+	}
+
+	return remoteName, nil
+}
+
+// IsOCIDir returns true if the name refers to a local OCI image-layout directory.
+func (name RemoteName) IsOCIDir() bool {
+	return name.Registry == RegistryOCIDir
+}
+
 func (name RemoteName) String() string {
-	result := strings.Join([]string{name.Registry, name.Namespace}, "/")
+	var result string
+
+	if name.IsOCIDir() {
+		result = OCIDirScheme + "/" + name.Namespace
+	} else {
+		result = strings.Join([]string{name.Registry, name.Namespace}, "/")
+	}
 
 	if name.Tag != "" {
 		result += ":" + name.Tag
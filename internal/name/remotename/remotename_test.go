@@ -3,6 +3,9 @@ package remotename_test
 import (
 	"github.com/cirruslabs/vetu/internal/name/remotename"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -141,3 +144,49 @@ func TestNotARemoteName(t *testing.T) {
 		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
 	require.ErrorIs(t, err, remotename.ErrNotARemoteName)
 }
+
+func TestValidOCIDir(t *testing.T) {
+	parsedRemoteName, err := remotename.NewFromString("ocidir:///srv/mirror/ubuntu:22.04")
+	require.NoError(t, err)
+	require.Equal(t, remotename.RemoteName{
+		Registry:  remotename.RegistryOCIDir,
+		Namespace: "srv/mirror/ubuntu",
+		Tag:       "22.04",
+	}, parsedRemoteName)
+	require.True(t, parsedRemoteName.IsOCIDir())
+	require.Equal(t, "ocidir:///srv/mirror/ubuntu:22.04", parsedRemoteName.String())
+
+	parsedRemoteName, err = remotename.NewFromString("ocidir:///srv/mirror/ubuntu@sha256:" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	require.NoError(t, err)
+	require.Equal(t, remotename.RemoteName{
+		Registry:  remotename.RegistryOCIDir,
+		Namespace: "srv/mirror/ubuntu",
+		Digest:    "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}, parsedRemoteName)
+}
+
+func TestOCIDirDefaultsToLatestTag(t *testing.T) {
+	parsedRemoteName, err := remotename.NewFromString("ocidir:///srv/mirror/ubuntu")
+	require.NoError(t, err)
+	require.Equal(t, "latest", parsedRemoteName.Tag)
+}
+
+func TestOCIDirRelativePath(t *testing.T) {
+	workingDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	parsedRemoteName, err := remotename.NewFromString("ocidir://layout:latest")
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimPrefix(filepath.Join(workingDir, "layout"), "/"),
+		parsedRemoteName.Namespace)
+}
+
+func TestOCIDirPathTraversal(t *testing.T) {
+	parsedRemoteName, err := remotename.NewFromString("ocidir:///srv/../../etc/layout:latest")
+	require.NoError(t, err)
+	require.Equal(t, "etc/layout", parsedRemoteName.Namespace)
+
+	_, err = remotename.NewFromString("ocidir:///..:latest")
+	require.ErrorIs(t, err, remotename.ErrFailedToParse)
+}
@@ -0,0 +1,28 @@
+package arp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+var ErrNotFound = errors.New("not found in the ARP cache")
+
+// Lookup returns the IP address of the neighbor with the specified
+// hardware address from the kernel's ARP cache.
+func Lookup(hardwareAddr net.HardwareAddr) (string, error) {
+	neighbors, err := netlink.NeighList(0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for _, neigh := range neighbors {
+		if bytes.Equal(neigh.HardwareAddr, hardwareAddr) {
+			return neigh.IP.String(), nil
+		}
+	}
+
+	return "", ErrNotFound
+}
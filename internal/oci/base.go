@@ -0,0 +1,142 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cirruslabs/vetu/internal/oci/annotations"
+	"github.com/cirruslabs/vetu/internal/oci/diskcompression"
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/descriptor"
+	manifestpkg "github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// baseImage is a previously pushed VM image, whose compressed disk
+// layers can be reused when their uncompressed contents match.
+type baseImage struct {
+	reference  ref.Ref
+	diskLayers map[baseDiskLayerKey]descriptor.Descriptor
+}
+
+type baseDiskLayerKey struct {
+	MediaType          string
+	UncompressedSize   int64
+	UncompressedDigest digest.Digest
+}
+
+type pushStats struct {
+	reused   atomic.Int64
+	existing atomic.Int64
+	uploaded atomic.Int64
+}
+
+func loadBaseImage(ctx context.Context, client *regclient.RegClient, reference ref.Ref) (*baseImage, error) {
+	fmt.Printf("pulling base image manifest %s...\n", reference.CommonName())
+
+	manifest, _, err := ResolveManifest(ctx, client, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the base image manifest: %w", err)
+	}
+
+	imager, ok := manifest.(manifestpkg.Imager)
+	if !ok {
+		return nil, fmt.Errorf("base image %s is not an image manifest", reference.CommonName())
+	}
+
+	layers, err := imager.GetLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pin the base image reference to the manifest's digest
+	// to make sure that we copy the blobs from the same image
+	// in case the tag is updated in the meantime
+	result := &baseImage{
+		reference:  reference.SetDigest(manifest.GetDescriptor().Digest.String()),
+		diskLayers: map[baseDiskLayerKey]descriptor.Descriptor{},
+	}
+
+	for _, layer := range layers {
+		if !diskcompression.IsDiskMediaType(layer.MediaType) {
+			continue
+		}
+
+		uncompressedSize, err := strconv.ParseInt(layer.Annotations[annotations.AnnotationUncompressedSize], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		uncompressedDigest, err := digest.Parse(layer.Annotations[annotations.AnnotationUncompressedDigest])
+		if err != nil {
+			continue
+		}
+
+		result.diskLayers[baseDiskLayerKey{
+			MediaType:          layer.MediaType,
+			UncompressedSize:   uncompressedSize,
+			UncompressedDigest: uncompressedDigest,
+		}] = layer
+	}
+
+	return result, nil
+}
+
+// reuse looks up a disk layer in the base image with the same uncompressed contents
+// and makes sure that its blob is available in the target repository.
+func (base *baseImage) reuse(
+	ctx context.Context,
+	client *regclient.RegClient,
+	reference ref.Ref,
+	key baseDiskLayerKey,
+) (descriptor.Descriptor, bool, error) {
+	baseDesc, ok := base.diskLayers[key]
+	if !ok {
+		return descriptor.Descriptor{}, false, nil
+	}
+
+	// Cross-repository mount or copy the blob if the target repository
+	// doesn't have it yet, see regclient.RegClient.BlobCopy() for details
+	if !blobExists(ctx, client, reference, baseDesc) {
+		if err := client.BlobCopy(ctx, base.reference, reference, baseDesc); err != nil {
+			return descriptor.Descriptor{}, false, err
+		}
+	}
+
+	return descriptor.Descriptor{
+		MediaType: baseDesc.MediaType,
+		Size:      baseDesc.Size,
+		Digest:    baseDesc.Digest,
+	}, true, nil
+}
+
+func blobExists(
+	ctx context.Context,
+	client *regclient.RegClient,
+	reference ref.Ref,
+	desc descriptor.Descriptor,
+) bool {
+	blobReader, err := client.BlobHead(ctx, reference, desc)
+	if err != nil {
+		return false
+	}
+
+	_ = blobReader.Close()
+
+	return true
+}
+
+func hashWindow(src io.ReaderAt, offset int64, size int64) (int64, digest.Digest, error) {
+	digester := digest.SHA256.Digester()
+
+	n, err := io.Copy(digester.Hash(), io.NewSectionReader(src, offset, size))
+	if err != nil {
+		return 0, "", err
+	}
+
+	return n, digester.Digest(), nil
+}
@@ -0,0 +1,157 @@
+package diskcompression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cirruslabs/vetu/internal/oci/mediatypes"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+var ErrUnsupported = errors.New("unsupported disk compression")
+
+type Algorithm string
+
+const (
+	AlgorithmLZ4  Algorithm = "lz4"
+	AlgorithmZstd Algorithm = "zstd"
+	AlgorithmNone Algorithm = "none"
+)
+
+var Algorithms = []Algorithm{AlgorithmLZ4, AlgorithmZstd, AlgorithmNone}
+
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5,
+	lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+// Compression describes how the disk layers are compressed when pushing.
+type Compression struct {
+	Algorithm Algorithm
+
+	// Level is the algorithm-specific compression level,
+	// zero means the algorithm's default level
+	Level int
+}
+
+func New(algorithm string, level int) (Compression, error) {
+	compression := Compression{
+		Algorithm: Algorithm(strings.ToLower(algorithm)),
+		Level:     level,
+	}
+
+	var maxLevel int
+
+	switch compression.Algorithm {
+	case AlgorithmLZ4:
+		maxLevel = len(lz4Levels)
+	case AlgorithmZstd:
+		maxLevel = 22
+	case AlgorithmNone:
+		maxLevel = 0
+	default:
+		return Compression{}, fmt.Errorf("%w: %q, supported algorithms are: %s", ErrUnsupported,
+			algorithm, strings.Join(algorithmNames(), ", "))
+	}
+
+	if level < 0 || level > maxLevel {
+		if maxLevel == 0 {
+			return Compression{}, fmt.Errorf("%w: %s compression does not support levels",
+				ErrUnsupported, compression.Algorithm)
+		}
+
+		return Compression{}, fmt.Errorf("%w: %s compression level should be in range 1-%d",
+			ErrUnsupported, compression.Algorithm, maxLevel)
+	}
+
+	return compression, nil
+}
+
+func (compression Compression) MediaType() string {
+	switch compression.Algorithm {
+	case AlgorithmZstd:
+		return mediatypes.MediaTypeDiskZstd
+	case AlgorithmNone:
+		return mediatypes.MediaTypeDiskRaw
+	default:
+		return mediatypes.MediaTypeDisk
+	}
+}
+
+func (compression Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch compression.Algorithm {
+	case AlgorithmZstd:
+		// Disk layers are already compressed in parallel,
+		// so no need for the additional concurrency here
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+
+		if compression.Level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compression.Level)))
+		}
+
+		return zstd.NewWriter(w, opts...)
+	case AlgorithmNone:
+		return nopWriteCloser{w}, nil
+	default:
+		writer := lz4.NewWriter(w)
+
+		if compression.Level != 0 {
+			if err := writer.Apply(lz4.CompressionLevelOption(lz4Levels[compression.Level-1])); err != nil {
+				return nil, err
+			}
+		}
+
+		return writer, nil
+	}
+}
+
+// IsDiskMediaType returns true if the media type corresponds
+// to a Vetu disk layer, regardless of its compression.
+func IsDiskMediaType(mediaType string) bool {
+	switch mediaType {
+	case mediatypes.MediaTypeDisk, mediatypes.MediaTypeDiskZstd, mediatypes.MediaTypeDiskRaw:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewReader returns a decompressing reader for the Vetu disk layer of the specified media type.
+func NewReader(mediaType string, r io.Reader) (io.ReadCloser, error) {
+	switch mediaType {
+	case mediatypes.MediaTypeDisk:
+		return io.NopCloser(lz4.NewReader(r)), nil
+	case mediatypes.MediaTypeDiskZstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	case mediatypes.MediaTypeDiskRaw:
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown disk layer media type %q", ErrUnsupported, mediaType)
+	}
+}
+
+func algorithmNames() []string {
+	var result []string
+
+	for _, algorithm := range Algorithms {
+		result = append(result, string(algorithm))
+	}
+
+	return result
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
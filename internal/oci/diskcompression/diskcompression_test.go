@@ -0,0 +1,57 @@
+package diskcompression_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/cirruslabs/vetu/internal/oci/diskcompression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello, World!\n"), 64*1024)
+
+	for _, algorithm := range diskcompression.Algorithms {
+		for _, level := range []int{0, 1} {
+			if algorithm == diskcompression.AlgorithmNone && level != 0 {
+				continue
+			}
+
+			compression, err := diskcompression.New(string(algorithm), level)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+
+			writer, err := compression.NewWriter(&buf)
+			require.NoError(t, err)
+			_, err = writer.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			require.True(t, diskcompression.IsDiskMediaType(compression.MediaType()))
+
+			reader, err := diskcompression.NewReader(compression.MediaType(), &buf)
+			require.NoError(t, err)
+			actualData, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+
+			require.Equal(t, data, actualData, "algorithm %s, level %d", algorithm, level)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	_, err := diskcompression.New("gzip", 0)
+	require.ErrorIs(t, err, diskcompression.ErrUnsupported)
+
+	_, err = diskcompression.New("none", 1)
+	require.ErrorIs(t, err, diskcompression.ErrUnsupported)
+
+	_, err = diskcompression.New("lz4", 10)
+	require.ErrorIs(t, err, diskcompression.ErrUnsupported)
+
+	_, err = diskcompression.New("zstd", 23)
+	require.ErrorIs(t, err, diskcompression.ErrUnsupported)
+}
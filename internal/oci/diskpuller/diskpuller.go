@@ -2,12 +2,15 @@ package diskpuller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/cirruslabs/vetu/internal/progresshelper"
 	"github.com/cirruslabs/vetu/internal/sparseio"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/cirruslabs/vetu/internal/zerocopy"
 	"github.com/dustin/go-humanize"
+	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/descriptor"
 	"github.com/regclient/regclient/types/ref"
@@ -21,13 +24,24 @@ import (
 	"strconv"
 )
 
+var ErrVerificationFailed = errors.New("disk layer verification failed")
+
 type NameFromDiskDescriptorFunc func(diskDescriptor descriptor.Descriptor) (string, error)
-type InitializeDecompressorFunc func(compressedReader io.Reader) io.Reader
+type InitializeDecompressorFunc func(diskDescriptor descriptor.Descriptor, compressedReader io.Reader) (io.ReadCloser, error)
 
 type diskTask struct {
-	Desc   descriptor.Descriptor
-	Path   string
+	Desc               descriptor.Descriptor
+	Name               string
+	Path               string
+	Offset             int64
+	UncompressedSize   int64
+	UncompressedDigest digest.Digest
+}
+
+type localDiskLayerKey struct {
 	Offset int64
+	Size   int64
+	Digest digest.Digest
 }
 
 func PullDisks(
@@ -36,9 +50,11 @@ func PullDisks(
 	reference ref.Ref,
 	vmDir *vmdirectory.VMDirectory,
 	concurrency int,
+	localVMDirs []*vmdirectory.VMDirectory,
 	disks []descriptor.Descriptor,
 	nameFromDiskDescriptor NameFromDiskDescriptorFunc,
 	uncompressedSizeAnnotation string,
+	uncompressedDigestAnnotation string,
 	initializeDecompressor InitializeDecompressorFunc,
 ) error {
 	// Process VM's disks by converting them into
@@ -63,10 +79,25 @@ func PullDisks(
 			return err
 		}
 
+		// Extract and parse uncompressed digest, which is optional
+		// and only used to find matching disk layers locally
+		var uncompressedDigest digest.Digest
+
+		if uncompressedDigestRaw, ok := disk.Annotations[uncompressedDigestAnnotation]; ok {
+			uncompressedDigest, err = digest.Parse(uncompressedDigestRaw)
+			if err != nil {
+				return fmt.Errorf("disk layer has invalid %s annotation: %w",
+					uncompressedDigestAnnotation, err)
+			}
+		}
+
 		diskTasks = append(diskTasks, &diskTask{
-			Desc:   disk,
-			Path:   filepath.Join(vmDir.Path(), diskName),
-			Offset: diskNameToOffset[diskName],
+			Desc:               disk,
+			Name:               diskName,
+			Path:               filepath.Join(vmDir.Path(), diskName),
+			Offset:             diskNameToOffset[diskName],
+			UncompressedSize:   uncompressedSize,
+			UncompressedDigest: uncompressedDigest,
 		})
 
 		diskNameToOffset[diskName] += uncompressedSize
@@ -88,10 +119,33 @@ func PullDisks(
 		}
 	}
 
+	// Skip the disk tasks that were completed by the previous
+	// pull attempt, if this pull was interrupted before
+	journal, err := openJournal(vmDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = journal.Close()
+	}()
+
+	pendingDiskTasks, err := resumeDiskTasks(diskTasks, journal)
+	if err != nil {
+		return err
+	}
+
+	// Copy the disk layers that are already available locally
+	// (for example, in other VM images from the OCI cache)
+	// and only pull the rest of them from the registry
+	remoteDiskTasks, err := reuseLocalDiskLayers(pendingDiskTasks, localVMDirs, journal)
+	if err != nil {
+		return err
+	}
+
 	// Indicate that we're started pulling and show the progress bar
 	totalUncompressedDisksSizeBytes := lo.Sum(lo.Values(diskNameToOffset))
-	totalCompressedDisksSizeBytes := lo.Sum(lo.Map(disks, func(diskDesc descriptor.Descriptor, index int) int64 {
-		return diskDesc.Size
+	totalCompressedDisksSizeBytes := lo.Sum(lo.Map(remoteDiskTasks, func(diskTask *diskTask, index int) int64 {
+		return diskTask.Desc.Size
 	}))
 	fmt.Printf("pulling %d disk(s) (%s compressed, %s uncompressed)...\n", len(diskNameToOffset),
 		humanize.Bytes(uint64(totalCompressedDisksSizeBytes)),
@@ -110,13 +164,17 @@ func PullDisks(
 
 	diskTasksGroup.SetLimit(concurrency)
 
-	for _, diskTask := range diskTasks {
+	for _, diskTask := range remoteDiskTasks {
 		if diskTasksCtx.Err() != nil {
 			break
 		}
 
 		diskTasksGroup.Go(func() error {
-			return diskTask.process(diskTasksCtx, client, reference, progressBar, initializeDecompressor)
+			if err := diskTask.process(diskTasksCtx, client, reference, progressBar, initializeDecompressor); err != nil {
+				return err
+			}
+
+			return journal.Record(diskTask)
 		})
 	}
 
@@ -131,8 +189,211 @@ func PullDisks(
 	if diskTasksErr != nil {
 		return diskTasksErr
 	}
+	if finishErr != nil {
+		return finishErr
+	}
+
+	// Record the disk layers that we've pulled to make
+	// them available for reuse in the subsequent pulls
+	var diskLayers []vmdirectory.DiskLayer
+
+	for _, diskTask := range diskTasks {
+		if diskTask.UncompressedDigest == "" {
+			continue
+		}
+
+		diskLayers = append(diskLayers, vmdirectory.DiskLayer{
+			Disk:   diskTask.Name,
+			Offset: diskTask.Offset,
+			Size:   diskTask.UncompressedSize,
+			Digest: diskTask.UncompressedDigest,
+		})
+	}
+
+	if err := vmDir.SetDiskLayers(diskLayers); err != nil {
+		return err
+	}
 
-	return finishErr
+	// The pull is complete, so there's nothing to resume anymore
+	return journal.Remove()
+}
+
+func resumeDiskTasks(diskTasks []*diskTask, journal *journal) ([]*diskTask, error) {
+	if !journal.Resumed() {
+		return diskTasks, nil
+	}
+
+	var pendingDiskTasks []*diskTask
+
+	for _, diskTask := range diskTasks {
+		// Re-verify the completed disk tasks, because the disk
+		// data might've not been persisted before the interruption
+		//
+		// Note that the completed disk tasks without an uncompressed
+		// digest (e.g. from the Tart VM images) cannot be verified,
+		// so they are always pulled again.
+		if journal.Completed(diskTask) {
+			ok, err := diskTask.verify()
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				continue
+			}
+		}
+
+		// The disk task might have been partially completed,
+		// so clean up its range, otherwise the stale data
+		// will be left in place when writing sparsely
+		if err := diskTask.punchHole(); err != nil {
+			return nil, err
+		}
+
+		pendingDiskTasks = append(pendingDiskTasks, diskTask)
+	}
+
+	fmt.Printf("resuming the previous pull, %d of %d disk layer(s) were already pulled...\n",
+		len(diskTasks)-len(pendingDiskTasks), len(diskTasks))
+
+	return pendingDiskTasks, nil
+}
+
+func reuseLocalDiskLayers(
+	diskTasks []*diskTask,
+	localVMDirs []*vmdirectory.VMDirectory,
+	journal *journal,
+) ([]*diskTask, error) {
+	// Index the disk layers that are available locally
+	localDiskLayers := map[localDiskLayerKey]string{}
+
+	for _, localVMDir := range localVMDirs {
+		diskLayers, err := localVMDir.DiskLayers()
+		if err != nil {
+			// Not critical, we'll just pull these disk layers from the registry
+			continue
+		}
+
+		for _, diskLayer := range diskLayers {
+			localDiskLayers[localDiskLayerKey{
+				Offset: diskLayer.Offset,
+				Size:   diskLayer.Size,
+				Digest: diskLayer.Digest,
+			}] = filepath.Join(localVMDir.Path(), diskLayer.Disk)
+		}
+	}
+
+	var remoteDiskTasks []*diskTask
+	var reusedCompressedBytes, reusedUncompressedBytes int64
+
+	for _, diskTask := range diskTasks {
+		if diskTask.UncompressedDigest == "" {
+			remoteDiskTasks = append(remoteDiskTasks, diskTask)
+
+			continue
+		}
+
+		localDiskPath, ok := localDiskLayers[localDiskLayerKey{
+			Offset: diskTask.Offset,
+			Size:   diskTask.UncompressedSize,
+			Digest: diskTask.UncompressedDigest,
+		}]
+		if !ok {
+			remoteDiskTasks = append(remoteDiskTasks, diskTask)
+
+			continue
+		}
+
+		if err := diskTask.copyFrom(localDiskPath); err != nil {
+			// The local VM image might've been garbage collected in the meantime,
+			// fall back to pulling this disk layer from the registry
+			remoteDiskTasks = append(remoteDiskTasks, diskTask)
+
+			continue
+		}
+
+		if err := journal.Record(diskTask); err != nil {
+			return nil, err
+		}
+
+		reusedCompressedBytes += diskTask.Desc.Size
+		reusedUncompressedBytes += diskTask.UncompressedSize
+	}
+
+	if reused := len(diskTasks) - len(remoteDiskTasks); reused != 0 {
+		fmt.Printf("reused %d disk layer(s) from the local cache, saving %s of download (%s uncompressed)...\n",
+			reused, humanize.Bytes(uint64(reusedCompressedBytes)), humanize.Bytes(uint64(reusedUncompressedBytes)))
+	}
+
+	return remoteDiskTasks, nil
+}
+
+func (diskTask *diskTask) verify() (bool, error) {
+	// We can't verify the disk tasks without an uncompressed digest
+	if diskTask.UncompressedDigest == "" {
+		return false, nil
+	}
+
+	diskFile, err := os.Open(diskTask.Path)
+	if err != nil {
+		return false, err
+	}
+	defer diskFile.Close()
+
+	digester := diskTask.UncompressedDigest.Algorithm().Digester()
+
+	if _, err := io.Copy(digester.Hash(), io.NewSectionReader(diskFile, diskTask.Offset,
+		diskTask.UncompressedSize)); err != nil {
+		return false, err
+	}
+
+	return digester.Digest() == diskTask.UncompressedDigest, nil
+}
+
+func (diskTask *diskTask) punchHole() error {
+	diskFile, err := os.OpenFile(diskTask.Path, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := sparseio.PunchHole(diskFile, diskTask.Offset, diskTask.UncompressedSize); err != nil {
+		_ = diskFile.Close()
+
+		return err
+	}
+
+	return diskFile.Close()
+}
+
+func (diskTask *diskTask) copyFrom(localDiskPath string) error {
+	localDiskFile, err := os.Open(localDiskPath)
+	if err != nil {
+		return err
+	}
+	defer localDiskFile.Close()
+
+	diskFile, err := os.OpenFile(diskTask.Path, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer diskFile.Close()
+
+	// Try to share the underlying blocks with the local disk first,
+	// which is instant and takes no additional space
+	if err := zerocopy.CloneRange(int(diskFile.Fd()), diskTask.Offset, int(localDiskFile.Fd()),
+		diskTask.Offset, diskTask.UncompressedSize); err == nil {
+		return diskFile.Close()
+	}
+
+	// Fall back to copying, while preserving the sparseness of the disk
+	diskFileAtOffset := io.NewOffsetWriter(diskFile, diskTask.Offset)
+	localDiskAtOffset := io.NewSectionReader(localDiskFile, diskTask.Offset, diskTask.UncompressedSize)
+
+	if err := sparseio.Copy(diskFileAtOffset, localDiskAtOffset); err != nil {
+		return err
+	}
+
+	return diskFile.Close()
 }
 
 func (diskTask *diskTask) process(
@@ -157,13 +418,47 @@ func (diskTask *diskTask) process(
 	}
 	defer blobReader.Close()
 
-	// Decompress the disk data on-the-fly and write it to the disk file
+	// Decompress the disk data on-the-fly and write it to the disk file,
+	// while calculating the digest of the decompressed data for verification
 	progressBarReader := progressbar.NewReader(blobReader, progressBar)
-	decompressor := initializeDecompressor(&progressBarReader)
+	decompressor, err := initializeDecompressor(diskTask.Desc, &progressBarReader)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	digester := digest.Canonical.Digester()
 
-	if err := sparseio.Copy(diskFileAtOffset, decompressor); err != nil {
+	if diskTask.UncompressedDigest != "" {
+		digester = diskTask.UncompressedDigest.Algorithm().Digester()
+	}
+
+	var uncompressedSize int64
+
+	if err := sparseio.Copy(diskFileAtOffset, io.TeeReader(decompressor,
+		io.MultiWriter(digester.Hash(), &counter{&uncompressedSize}))); err != nil {
 		return err
 	}
 
+	if uncompressedSize != diskTask.UncompressedSize {
+		return fmt.Errorf("%w: disk layer %s decompressed to %d bytes, expected %d bytes",
+			ErrVerificationFailed, diskTask.Desc.Digest, uncompressedSize, diskTask.UncompressedSize)
+	}
+
+	if diskTask.UncompressedDigest != "" && digester.Digest() != diskTask.UncompressedDigest {
+		return fmt.Errorf("%w: disk layer %s decompressed to data with digest %s, expected %s",
+			ErrVerificationFailed, diskTask.Desc.Digest, digester.Digest(), diskTask.UncompressedDigest)
+	}
+
 	return diskFile.Close()
 }
+
+type counter struct {
+	n *int64
+}
+
+func (counter *counter) Write(p []byte) (int, error) {
+	*counter.n += int64(len(p))
+
+	return len(p), nil
+}
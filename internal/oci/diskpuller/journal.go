@@ -0,0 +1,134 @@
+package diskpuller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/opencontainers/go-digest"
+)
+
+const journalName = ".pull-journal"
+
+// journal keeps track of the disk tasks that were completed,
+// which allows an interrupted pull to be resumed later.
+type journal struct {
+	file    *os.File
+	entries map[journalEntry]struct{}
+	resumed bool
+	mtx     sync.Mutex
+}
+
+type journalEntry struct {
+	Digest digest.Digest `json:"digest"`
+	Disk   string        `json:"disk"`
+	Offset int64         `json:"offset"`
+}
+
+func openJournal(vmDir *vmdirectory.VMDirectory) (*journal, error) {
+	path := filepath.Join(vmDir.Path(), journalName)
+
+	result := &journal{
+		entries: map[journalEntry]struct{}{},
+	}
+
+	journalBytes, err := os.ReadFile(path)
+	if err == nil {
+		result.resumed = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// The last entry might be incomplete if we were interrupted while writing it,
+	// so only consider the complete entries and drop the rest, otherwise the next
+	// entry will be appended to the incomplete one and will be lost too
+	completeLength := bytes.LastIndexByte(journalBytes, '\n') + 1
+
+	for _, line := range bytes.Split(journalBytes[:completeLength], []byte{'\n'}) {
+		var entry journalEntry
+
+		// Simply ignore the unparseable entries
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+
+		result.entries[entry] = struct{}{}
+	}
+
+	result.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.file.Truncate(int64(completeLength)); err != nil {
+		_ = result.file.Close()
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Resumed returns true if the journal existed before,
+// which means that a previous pull was interrupted.
+func (journal *journal) Resumed() bool {
+	return journal.resumed
+}
+
+func (journal *journal) Completed(diskTask *diskTask) bool {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	_, ok := journal.entries[newJournalEntry(diskTask)]
+
+	return ok
+}
+
+func (journal *journal) Record(diskTask *diskTask) error {
+	journal.mtx.Lock()
+	defer journal.mtx.Unlock()
+
+	entry := newJournalEntry(diskTask)
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := journal.file.Write(append(entryBytes, '\n')); err != nil {
+		return err
+	}
+
+	if err := journal.file.Sync(); err != nil {
+		return err
+	}
+
+	journal.entries[entry] = struct{}{}
+
+	return nil
+}
+
+func (journal *journal) Close() error {
+	return journal.file.Close()
+}
+
+// Remove removes the journal once the pull is complete.
+func (journal *journal) Remove() error {
+	if err := journal.file.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(journal.file.Name())
+}
+
+func newJournalEntry(diskTask *diskTask) journalEntry {
+	return journalEntry{
+		Digest: diskTask.Desc.Digest,
+		Disk:   diskTask.Name,
+		Offset: diskTask.Offset,
+	}
+}
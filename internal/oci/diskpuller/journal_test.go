@@ -0,0 +1,174 @@
+package diskpuller
+
+import (
+	cryptorand "crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types/descriptor"
+	"github.com/stretchr/testify/require"
+)
+
+const testLayerSize = 64 * 1024
+
+func TestJournalTruncatedLastEntry(t *testing.T) {
+	vmDir := createTestVMDir(t)
+	diskTasks := createTestDiskTasks(t, vmDir, 3)
+
+	journal, err := openJournal(vmDir)
+	require.NoError(t, err)
+	require.False(t, journal.Resumed())
+	require.NoError(t, journal.Record(diskTasks[0]))
+	require.NoError(t, journal.Close())
+
+	// Simulate an interruption while writing the second entry
+	journalFile, err := os.OpenFile(filepath.Join(vmDir.Path(), journalName), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = journalFile.WriteString(`{"digest":"sha256:`)
+	require.NoError(t, err)
+	require.NoError(t, journalFile.Close())
+
+	journal, err = openJournal(vmDir)
+	require.NoError(t, err)
+	require.True(t, journal.Resumed())
+	require.True(t, journal.Completed(diskTasks[0]))
+	require.False(t, journal.Completed(diskTasks[1]))
+
+	// The entries recorded after the incomplete one should be readable too
+	require.NoError(t, journal.Record(diskTasks[1]))
+	require.NoError(t, journal.Close())
+
+	journal, err = openJournal(vmDir)
+	require.NoError(t, err)
+	require.True(t, journal.Completed(diskTasks[0]))
+	require.True(t, journal.Completed(diskTasks[1]))
+	require.False(t, journal.Completed(diskTasks[2]))
+	require.NoError(t, journal.Close())
+}
+
+func TestResumeDiskTasks(t *testing.T) {
+	vmDir := createTestVMDir(t)
+	diskTasks := createTestDiskTasks(t, vmDir, 4)
+
+	// Without a journal, all of the disk tasks
+	// are pending and the disk is left untouched
+	journal, err := openJournal(vmDir)
+	require.NoError(t, err)
+
+	pendingDiskTasks, err := resumeDiskTasks(diskTasks, journal)
+	require.NoError(t, err)
+	require.Equal(t, diskTasks, pendingDiskTasks)
+
+	// Complete all of the disk tasks but the last one
+	for _, diskTask := range diskTasks[:3] {
+		require.NoError(t, journal.Record(diskTask))
+	}
+	require.NoError(t, journal.Close())
+
+	// Corrupt the second disk task's data, which was not persisted
+	// before the interruption, and drop the third disk task's
+	// uncompressed digest, which makes it impossible to verify
+	diskFile, err := os.OpenFile(diskTasks[1].Path, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = diskFile.WriteAt([]byte("corrupted"), diskTasks[1].Offset)
+	require.NoError(t, err)
+	require.NoError(t, diskFile.Close())
+
+	diskTasks[2].UncompressedDigest = ""
+
+	expectedFirstLayer := readRange(t, diskTasks[0])
+
+	journal, err = openJournal(vmDir)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	pendingDiskTasks, err = resumeDiskTasks(diskTasks, journal)
+	require.NoError(t, err)
+	require.Equal(t, diskTasks[1:], pendingDiskTasks)
+
+	// Verified disk task's data should be kept as is,
+	// whereas the pending disk tasks' data should be
+	// hole-punched to avoid leaving stale data behind
+	require.Equal(t, expectedFirstLayer, readRange(t, diskTasks[0]))
+
+	for _, diskTask := range pendingDiskTasks {
+		require.Equal(t, make([]byte, testLayerSize), readRange(t, diskTask))
+	}
+}
+
+func TestJournalRemove(t *testing.T) {
+	vmDir := createTestVMDir(t)
+	diskTasks := createTestDiskTasks(t, vmDir, 1)
+
+	journal, err := openJournal(vmDir)
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(diskTasks[0]))
+	require.NoError(t, journal.Remove())
+
+	_, err = os.Stat(filepath.Join(vmDir.Path(), journalName))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Successful pull leaves nothing to resume
+	journal, err = openJournal(vmDir)
+	require.NoError(t, err)
+	require.False(t, journal.Resumed())
+	require.False(t, journal.Completed(diskTasks[0]))
+	require.NoError(t, journal.Close())
+}
+
+func createTestVMDir(t *testing.T) *vmdirectory.VMDirectory {
+	t.Setenv("VETU_HOME", filepath.Join(t.TempDir(), ".vetu"))
+
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	return vmDir
+}
+
+// createTestDiskTasks creates a disk filled with random data
+// and returns the completed disk tasks that cover it.
+func createTestDiskTasks(t *testing.T, vmDir *vmdirectory.VMDirectory, count int) []*diskTask {
+	diskPath := filepath.Join(vmDir.Path(), "disk.img")
+
+	diskBytes := make([]byte, count*testLayerSize)
+	_, err := cryptorand.Read(diskBytes)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(diskPath, diskBytes, 0600))
+
+	var result []*diskTask
+
+	for i := range count {
+		layerBytes := diskBytes[i*testLayerSize : (i+1)*testLayerSize]
+
+		result = append(result, &diskTask{
+			Desc: descriptor.Descriptor{
+				// Compressed digest only needs to be unique for the journal
+				Digest: digest.FromBytes(append([]byte("compressed"), layerBytes...)),
+			},
+			Name:               "disk.img",
+			Path:               diskPath,
+			Offset:             int64(i * testLayerSize),
+			UncompressedSize:   testLayerSize,
+			UncompressedDigest: digest.FromBytes(layerBytes),
+		})
+	}
+
+	return result
+}
+
+func readRange(t *testing.T, diskTask *diskTask) []byte {
+	diskFile, err := os.Open(diskTask.Path)
+	require.NoError(t, err)
+	defer diskFile.Close()
+
+	result := make([]byte, diskTask.UncompressedSize)
+
+	_, err = diskFile.ReadAt(result, diskTask.Offset)
+	require.NoError(t, err)
+
+	return result
+}
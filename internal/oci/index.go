@@ -0,0 +1,155 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/descriptor"
+	"github.com/regclient/regclient/types/errs"
+	manifestpkg "github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/mediatype"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+var ErrNoMatchingPlatform = errors.New("no VM image for this platform")
+
+// Platform returns the platform of the VM images that are pushed from
+// and can be pulled to this host.
+func Platform() platform.Platform {
+	return platform.Platform{
+		Architecture: runtime.GOARCH,
+		OS:           runtime.GOOS,
+	}
+}
+
+// ResolveManifest retrieves the manifest for the reference, and if it's
+// an image index, the image manifest for this host's platform instead.
+//
+// The digest of the manifest or the image index that the reference
+// points to is returned too, since it's the one that identifies
+// the VM image from the user's perspective.
+func ResolveManifest(
+	ctx context.Context,
+	client *regclient.RegClient,
+	reference ref.Ref,
+) (manifestpkg.Manifest, digest.Digest, error) {
+	manifest, err := client.ManifestGet(ctx, reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !manifest.IsList() {
+		if _, ok := manifest.(manifestpkg.Imager); !ok {
+			return nil, "", fmt.Errorf("unsupported manifest type: %s", manifest.GetDescriptor().MediaType)
+		}
+
+		return manifest, manifest.GetDescriptor().Digest, nil
+	}
+
+	hostPlatform := Platform()
+
+	desc, err := manifestpkg.GetPlatformDesc(manifest, &hostPlatform)
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			platforms, _ := manifestpkg.GetPlatformList(manifest)
+
+			return nil, "", fmt.Errorf("%w: image index %s only contains VM images for %v, "+
+				"but %s is required", ErrNoMatchingPlatform, reference.CommonName(), platforms, hostPlatform)
+		}
+
+		return nil, "", err
+	}
+
+	platformManifest, err := client.ManifestGet(ctx, reference, regclient.WithManifestDesc(*desc))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, ok := platformManifest.(manifestpkg.Imager); !ok {
+		return nil, "", fmt.Errorf("unsupported manifest type: %s", platformManifest.GetDescriptor().MediaType)
+	}
+
+	return platformManifest, manifest.GetDescriptor().Digest, nil
+}
+
+// appendToIndex adds the image manifest to the image index that the reference
+// points to (creating one if necessary), replacing the image manifest for
+// the same platform (if any), and returns the digest of the updated index.
+func appendToIndex(
+	ctx context.Context,
+	client *regclient.RegClient,
+	reference ref.Ref,
+	imageDesc descriptor.Descriptor,
+) (digest.Digest, error) {
+	var manifests []descriptor.Descriptor
+
+	existing, err := client.ManifestGet(ctx, reference)
+	if err != nil && !errors.Is(err, errs.ErrNotFound) {
+		return "", err
+	}
+
+	if err == nil {
+		if existing.IsList() {
+			indexer, ok := existing.(manifestpkg.Indexer)
+			if !ok {
+				return "", fmt.Errorf("unsupported manifest type: %s", existing.GetDescriptor().MediaType)
+			}
+
+			manifests, err = indexer.GetManifestList()
+			if err != nil {
+				return "", err
+			}
+		} else {
+			// Convert the image manifest that was pushed without
+			// --append-to-index into an image index entry
+			existingConfig, err := client.ImageConfig(ctx, reference)
+			if err != nil {
+				return "", err
+			}
+
+			existingPlatform := existingConfig.GetConfig().Platform
+			existingDesc := existing.GetDescriptor()
+
+			manifests = append(manifests, descriptor.Descriptor{
+				MediaType: existingDesc.MediaType,
+				Size:      existingDesc.Size,
+				Digest:    existingDesc.Digest,
+				Platform:  &existingPlatform,
+			})
+		}
+	}
+
+	// Replace the image manifest for the same platform
+	var result []descriptor.Descriptor
+
+	for _, manifest := range manifests {
+		if manifest.Platform != nil && platform.Match(*manifest.Platform, *imageDesc.Platform) {
+			continue
+		}
+
+		result = append(result, manifest)
+	}
+
+	result = append(result, imageDesc)
+
+	index, err := manifestpkg.New(manifestpkg.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: mediatype.OCI1ManifestList,
+		Manifests: result,
+	}))
+	if err != nil {
+		return "", err
+	}
+
+	if err := client.ManifestPut(ctx, reference, index); err != nil {
+		return "", err
+	}
+
+	return index.GetDescriptor().Digest, nil
+}
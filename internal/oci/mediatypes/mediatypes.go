@@ -6,6 +6,11 @@ const (
 	MediaTypeInitramfs = "application/vnd.cirruslabs.vetu.initramfs.v1"
 	MediaTypeDisk      = "application/vnd.cirruslabs.vetu.disk.v1"
 
+	// MediaTypeDiskZstd and MediaTypeDiskRaw are the zstd-compressed
+	// and uncompressed variants of the (lz4-compressed) MediaTypeDisk
+	MediaTypeDiskZstd = "application/vnd.cirruslabs.vetu.disk.zstd.v1"
+	MediaTypeDiskRaw  = "application/vnd.cirruslabs.vetu.disk.raw.v1"
+
 	MediaTypeTartConfig = "application/vnd.cirruslabs.tart.config.v1"
 	MediaTypeTartDisk   = "application/vnd.cirruslabs.tart.disk.v2"
 )
@@ -21,6 +21,7 @@ func PullVMDirectory(
 	manifest manifestpkg.Manifest,
 	vmDir *vmdirectory.VMDirectory,
 	concurrency int,
+	localVMDirs []*vmdirectory.VMDirectory,
 ) error {
 	// Get layers
 	layers, err := manifest.(manifestpkg.Imager).GetLayers()
@@ -35,9 +36,9 @@ func PullVMDirectory(
 
 	switch {
 	case lo.Contains(mediaTypes, mediatypes.MediaTypeConfig):
-		return vetu.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency)
+		return vetu.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency, localVMDirs)
 	case lo.Contains(mediaTypes, mediatypes.MediaTypeTartConfig):
-		return tart.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency)
+		return tart.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency, localVMDirs)
 	default:
 		return fmt.Errorf("unsupported VM image type")
 	}
@@ -30,6 +30,7 @@ func PullVMDirectory(
 	manifest manifestpkg.Manifest,
 	vmDir *vmdirectory.VMDirectory,
 	concurrency int,
+	localVMDirs []*vmdirectory.VMDirectory,
 ) error {
 	// Get layers
 	layers, err := manifest.(manifestpkg.Imager).GetLayers()
@@ -71,7 +72,7 @@ func PullVMDirectory(
 	vmConfig.Disks = []vmconfig.Disk{
 		{Name: diskName},
 	}
-	vmConfig.CPUCount = tartConfig.CPUCount
+	vmConfig.CPUCount = uint16(tartConfig.CPUCount)
 	vmConfig.MemorySize = tartConfig.MemorySize
 	vmConfig.MACAddress = tartConfig.MACAddress
 
@@ -103,10 +104,10 @@ func PullVMDirectory(
 		return diskName, nil
 	}
 
-	decompressorFunc := func(r io.Reader) io.Reader {
-		return applestream.NewReader(r)
+	decompressorFunc := func(disk descriptor.Descriptor, r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(applestream.NewReader(r)), nil
 	}
 
-	return diskpuller.PullDisks(ctx, client, reference, vmDir, concurrency, disks, nameFunc,
-		annotations.AnnotationTartUncompressedSize, decompressorFunc)
+	return diskpuller.PullDisks(ctx, client, reference, vmDir, concurrency, localVMDirs, disks, nameFunc,
+		annotations.AnnotationTartUncompressedSize, annotations.AnnotationTartUncompressedDigest, decompressorFunc)
 }
@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/cirruslabs/vetu/internal/oci/annotations"
+	"github.com/cirruslabs/vetu/internal/oci/diskcompression"
 	"github.com/cirruslabs/vetu/internal/oci/diskpuller"
 	"github.com/cirruslabs/vetu/internal/oci/mediatypes"
 	"github.com/cirruslabs/vetu/internal/oci/pull/pullhelper"
 	"github.com/cirruslabs/vetu/internal/vmconfig"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
-	"github.com/pierrec/lz4/v4"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/descriptor"
 	manifestpkg "github.com/regclient/regclient/types/manifest"
@@ -26,6 +26,7 @@ func PullVMDirectory(
 	manifest manifestpkg.Manifest,
 	vmDir *vmdirectory.VMDirectory,
 	concurrency int,
+	localVMDirs []*vmdirectory.VMDirectory,
 ) error {
 	layers, err := manifest.(manifestpkg.Imager).GetLayers()
 	if err != nil {
@@ -103,7 +104,7 @@ func PullVMDirectory(
 
 	// Find VM's disks
 	disks := lo.Filter(layers, func(desc descriptor.Descriptor, index int) bool {
-		return desc.MediaType == mediatypes.MediaTypeDisk
+		return diskcompression.IsDiskMediaType(desc.MediaType)
 	})
 
 	// Pull VM's disks
@@ -124,10 +125,12 @@ func PullVMDirectory(
 		return diskName, nil
 	}
 
-	decompressorFunc := func(r io.Reader) io.Reader {
-		return lz4.NewReader(r)
+	// Each disk layer can be compressed differently,
+	// so pick the decompressor based on its media type
+	decompressorFunc := func(disk descriptor.Descriptor, r io.Reader) (io.ReadCloser, error) {
+		return diskcompression.NewReader(disk.MediaType, r)
 	}
 
-	return diskpuller.PullDisks(ctx, client, reference, vmDir, concurrency, disks, nameFunc,
-		annotations.AnnotationUncompressedSize, decompressorFunc)
+	return diskpuller.PullDisks(ctx, client, reference, vmDir, concurrency, localVMDirs, disks, nameFunc,
+		annotations.AnnotationUncompressedSize, annotations.AnnotationUncompressedDigest, decompressorFunc)
 }
@@ -9,37 +9,90 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strconv"
 
 	chunkerpkg "github.com/cirruslabs/vetu/internal/chunker"
 	"github.com/cirruslabs/vetu/internal/oci/annotations"
+	"github.com/cirruslabs/vetu/internal/oci/diskcompression"
 	"github.com/cirruslabs/vetu/internal/oci/mediatypes"
 	"github.com/cirruslabs/vetu/internal/progresshelper"
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
 	"github.com/cirruslabs/vetu/internal/vmdirectory"
 	"github.com/dustin/go-humanize"
 	"github.com/opencontainers/go-digest"
-	"github.com/pierrec/lz4/v4"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/descriptor"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/mediatype"
 	"github.com/regclient/regclient/types/oci/v1"
-	"github.com/regclient/regclient/types/platform"
 
 	"github.com/regclient/regclient/types/ref"
 	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
 )
 
-const targetDiskLayerSizeBytes = 500 * humanize.MByte
+const DefaultDiskLayerSizeBytes = 500 * humanize.MByte
+
+type PushOptions struct {
+	// DiskLayerSizeBytes is the size of the fixed-offset disk window
+	// that is compressed into a single disk layer, defaults to
+	// DefaultDiskLayerSizeBytes when not set
+	//
+	// Disk layers are spooled to temporary files before uploading,
+	// so this only affects the temporary disk space usage and the
+	// granularity of the uploads, but not the memory usage.
+	DiskLayerSizeBytes int
+
+	// Concurrency is the number of disk layers that are compressed
+	// and uploaded in parallel, defaults to 1 when not set
+	//
+	// This is what bounds the memory usage of the push, since each
+	// disk layer in progress only keeps the compressor's state and
+	// a small copy buffer in memory.
+	Concurrency int
+
+	// Compression is the compression used for the disk layers,
+	// defaults to lz4 with its default level when not set
+	Compression diskcompression.Compression
+
+	// AppendToIndex makes the VM image part of the image index
+	// that the reference points to instead of overwriting it,
+	// which allows publishing VM images for multiple platforms
+	// under the same tag
+	AppendToIndex bool
+
+	// Base is an optional reference to a previously pushed VM image,
+	// whose disk layers will be reused instead of compressing and
+	// uploading the disk windows with the same uncompressed contents
+	Base *ref.Ref
+}
 
 func PushVMDirectory(
 	ctx context.Context,
 	client *regclient.RegClient,
 	vmDir *vmdirectory.VMDirectory,
 	reference ref.Ref,
+	opts PushOptions,
 ) (digest.Digest, error) {
+	if opts.DiskLayerSizeBytes == 0 {
+		opts.DiskLayerSizeBytes = DefaultDiskLayerSizeBytes
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 1
+	}
+
+	var base *baseImage
+
+	if opts.Base != nil {
+		var err error
+
+		base, err = loadBaseImage(ctx, client, *opts.Base)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	fmt.Printf("pushing %s...\n", reference.CommonName())
 
 	// Create an OCI image manifest
@@ -50,10 +103,7 @@ func PushVMDirectory(
 
 	// Create an OCI image configuration
 	ociConfig := blob.NewOCIConfig(blob.WithImage(v1.Image{
-		Platform: platform.Platform{
-			Architecture: runtime.GOARCH,
-			OS:           runtime.GOOS,
-		},
+		Platform: Platform(),
 	}))
 
 	// Push the OCI image configuration and add
@@ -87,7 +137,7 @@ func PushVMDirectory(
 	ociManifest.Layers = append(ociManifest.Layers, vmKernelDesc)
 
 	// Push VM's initramfs (if any)
-	initramfsBytes, err := os.ReadFile(vmDir.InitramfsPath())
+	_, err = os.Stat(vmDir.InitramfsPath())
 	if err != nil {
 		// Report an error if the initramfs exists,
 		// but we cannot access it for some reason
@@ -97,8 +147,8 @@ func PushVMDirectory(
 	} else {
 		fmt.Println("pushing initramfs...")
 
-		vmInitramfsDesc, err := pushBytes(ctx, client, reference, initramfsBytes,
-			mediatypes.MediaTypeInitramfs, nil, nil)
+		vmInitramfsDesc, err := pushFile(ctx, client, reference, vmDir.InitramfsPath(),
+			mediatypes.MediaTypeInitramfs, nil)
 		if err != nil {
 			return "", err
 		}
@@ -112,15 +162,32 @@ func PushVMDirectory(
 		return "", err
 	}
 
+	// Disk layers are compressed to temporary files first
+	// to avoid holding them in memory when uploading
+	spoolDir, spoolLock, err := temporary.CreateDirTryLocked()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(spoolDir)
+		_ = spoolLock.Unlock()
+	}()
+
 	for _, disk := range vmConfig.Disks {
 		fmt.Printf("pushing disk %s...\n", disk.Name)
 
+		var stats pushStats
+
 		vmDiskDescriptors, err := pushDisk(ctx, client, reference, filepath.Join(vmDir.Path(), disk.Name),
-			disk.Name)
+			disk.Name, spoolDir, base, opts, &stats)
 		if err != nil {
 			return "", err
 		}
 
+		fmt.Printf("disk %s: %d layer(s) uploaded, %d layer(s) already existed, "+
+			"%d layer(s) reused from the base image\n", disk.Name, stats.uploaded.Load(),
+			stats.existing.Load(), stats.reused.Load())
+
 		ociManifest.Layers = append(ociManifest.Layers, vmDiskDescriptors...)
 	}
 
@@ -129,11 +196,33 @@ func PushVMDirectory(
 		return "", err
 	}
 
-	if err := client.ManifestPut(ctx, reference, m); err != nil {
+	if !opts.AppendToIndex {
+		if err := client.ManifestPut(ctx, reference, m); err != nil {
+			return "", err
+		}
+
+		return m.GetDescriptor().Digest, nil
+	}
+
+	// Push the image manifest by digest only, the tag
+	// will point to the image index that references it
+	desc := m.GetDescriptor()
+
+	if err := client.ManifestPut(ctx, reference.SetDigest(desc.Digest.String()), m,
+		regclient.WithManifestChild()); err != nil {
 		return "", err
 	}
 
-	return m.GetDescriptor().Digest, nil
+	hostPlatform := Platform()
+
+	fmt.Printf("appending the VM image for platform %s to the image index...\n", hostPlatform)
+
+	return appendToIndex(ctx, client, reference, descriptor.Descriptor{
+		MediaType: desc.MediaType,
+		Size:      desc.Size,
+		Digest:    desc.Digest,
+		Platform:  &hostPlatform,
+	})
 }
 
 func pushFile(
@@ -144,12 +233,40 @@ func pushFile(
 	mediaType string,
 	annotations map[string]string,
 ) (descriptor.Descriptor, error) {
-	fileBytes, err := os.ReadFile(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return descriptor.Descriptor{}, err
+	}
+	defer file.Close()
+
+	// Calculate the file's digest in a first pass
+	// to avoid reading the whole file into memory
+	fileDigest, err := digest.FromReader(file)
+	if err != nil {
+		return descriptor.Descriptor{}, err
+	}
+
+	fileInfo, err := file.Stat()
 	if err != nil {
 		return descriptor.Descriptor{}, err
 	}
 
-	return pushBytes(ctx, client, reference, fileBytes, mediaType, annotations, nil)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return descriptor.Descriptor{}, err
+	}
+
+	desc := descriptor.Descriptor{
+		MediaType:   mediaType,
+		Size:        fileInfo.Size(),
+		Digest:      fileDigest,
+		Annotations: annotations,
+	}
+
+	if blobExists(ctx, client, reference, desc) {
+		return desc, nil
+	}
+
+	return client.BlobPut(ctx, reference, desc, file)
 }
 
 func pushJSON(
@@ -165,7 +282,7 @@ func pushJSON(
 		return descriptor.Descriptor{}, err
 	}
 
-	return pushBytes(ctx, client, reference, jsonBytes, mediaType, annotations, nil)
+	return pushBytes(ctx, client, reference, jsonBytes, mediaType, annotations)
 }
 
 func pushBytes(
@@ -175,7 +292,6 @@ func pushBytes(
 	data []byte,
 	mediaType string,
 	annotations map[string]string,
-	progressBar *progressbar.ProgressBar,
 ) (descriptor.Descriptor, error) {
 	desc := descriptor.Descriptor{
 		MediaType:   mediaType,
@@ -184,19 +300,11 @@ func pushBytes(
 		Annotations: annotations,
 	}
 
-	var reader io.Reader
-
-	if progressBar != nil {
-		// Wrap in progress bar reader,
-		// if progress bar is supplied
-		progressBarReader := progressbar.NewReader(bytes.NewReader(data), progressBar)
-		reader = &progressBarReader
-	} else {
-		// Use plain reader
-		reader = bytes.NewReader(data)
+	if blobExists(ctx, client, reference, desc) {
+		return desc, nil
 	}
 
-	return client.BlobPut(ctx, reference, desc, reader)
+	return client.BlobPut(ctx, reference, desc, bytes.NewReader(data))
 }
 
 func pushDisk(
@@ -205,66 +313,155 @@ func pushDisk(
 	reference ref.Ref,
 	path string,
 	diskName string,
+	spoolDir string,
+	base *baseImage,
+	opts PushOptions,
+	stats *pushStats,
 ) ([]descriptor.Descriptor, error) {
-	var result []descriptor.Descriptor
-
 	diskFile, err := os.Open(path)
 	if err != nil {
 		return []descriptor.Descriptor{}, err
 	}
+	defer diskFile.Close()
 
-	chunker, err := chunkerpkg.NewChunker(targetDiskLayerSizeBytes, func(w io.Writer) (io.WriteCloser, error) {
-		return lz4.NewWriter(w), nil
-	})
+	diskFileInfo, err := diskFile.Stat()
 	if err != nil {
 		return []descriptor.Descriptor{}, err
 	}
 
-	errCh := make(chan error, 1)
+	// Split the disk into fixed-offset windows, each of which
+	// will be compressed and pushed as a separate layer
+	windowSize := int64(opts.DiskLayerSizeBytes)
+	windows := chunkerpkg.Windows(diskFileInfo.Size(), windowSize)
 
-	go func() {
-		if _, err := io.Copy(chunker, diskFile); err != nil {
-			errCh <- err
+	// Layers will be placed in the same order as the windows,
+	// regardless of the order in which they finish uploading
+	result := make([]descriptor.Descriptor, len(windows))
 
-			return
-		}
+	progressBar := progresshelper.DefaultBytes(-1)
 
-		if err := chunker.Close(); err != nil {
-			errCh <- err
+	// Compress and push windows with the specified concurrency
+	windowsGroup, windowsCtx := errgroup.WithContext(ctx)
 
-			return
+	windowsGroup.SetLimit(opts.Concurrency)
+
+	for index, offset := range windows {
+		if windowsCtx.Err() != nil {
+			break
 		}
 
-		errCh <- nil
-	}()
+		windowsGroup.Go(func() error {
+			// Try to reuse the base image's layer first, hashing
+			// the window is much cheaper than compressing it
+			if base != nil {
+				uncompressedSize, uncompressedDigest, err := hashWindow(diskFile, offset, windowSize)
+				if err != nil {
+					return err
+				}
+
+				diskDesc, ok, err := base.reuse(windowsCtx, client, reference, baseDiskLayerKey{
+					MediaType:          opts.Compression.MediaType(),
+					UncompressedSize:   uncompressedSize,
+					UncompressedDigest: uncompressedDigest,
+				})
+				if err != nil {
+					return err
+				}
+				if ok {
+					diskDesc.Annotations = diskLayerAnnotations(diskName, uncompressedSize, uncompressedDigest)
+					result[index] = diskDesc
+					stats.reused.Add(1)
+
+					return nil
+				}
+			}
+
+			compressedChunk, err := chunkerpkg.NewWindowChunk(diskFile, offset, windowSize,
+				opts.Compression.NewWriter, spoolDir)
+			if err != nil {
+				return err
+			}
+
+			diskDesc, err := pushChunk(windowsCtx, client, reference, compressedChunk,
+				opts.Compression.MediaType(), diskLayerAnnotations(diskName, compressedChunk.UncompressedSize,
+					compressedChunk.UncompressedDigest), progressBar, stats)
+			if err != nil {
+				return err
+			}
+
+			result[index] = diskDesc
+
+			return nil
+		})
+	}
 
-	progressBar := progresshelper.DefaultBytes(-1)
+	// Wait for the windows to be pushed
+	windowsErr := windowsGroup.Wait()
 
-	for compressedChunk := range chunker.Chunks() {
-		annotations := map[string]string{
-			annotations.AnnotationName:               diskName,
-			annotations.AnnotationUncompressedSize:   strconv.FormatInt(compressedChunk.UncompressedSize, 10),
-			annotations.AnnotationUncompressedDigest: compressedChunk.UncompressedDigest.String(),
-		}
+	// Since we've finished pushing the disk,
+	// we can finish the associated progress bar
+	finishErr := progressBar.Finish()
 
-		diskDesc, err := pushBytes(ctx, client, reference, compressedChunk.Data,
-			mediatypes.MediaTypeDisk, annotations, progressBar)
-		if err != nil {
-			return nil, err
-		}
+	// Prefer windowsErr over finishErr
+	if windowsErr != nil {
+		return nil, windowsErr
+	}
+	if finishErr != nil {
+		return nil, finishErr
+	}
 
-		result = append(result, diskDesc)
+	return result, nil
+}
+
+func diskLayerAnnotations(diskName string, uncompressedSize int64, uncompressedDigest digest.Digest) map[string]string {
+	return map[string]string{
+		annotations.AnnotationName:               diskName,
+		annotations.AnnotationUncompressedSize:   strconv.FormatInt(uncompressedSize, 10),
+		annotations.AnnotationUncompressedDigest: uncompressedDigest.String(),
 	}
+}
 
-	// Since we've finished pushing the disk,
-	// we can finish the associated progress bar
-	if err := progressBar.Finish(); err != nil {
-		return nil, err
+func pushChunk(
+	ctx context.Context,
+	client *regclient.RegClient,
+	reference ref.Ref,
+	chunk *chunkerpkg.Chunk,
+	mediaType string,
+	annotations map[string]string,
+	progressBar *progressbar.ProgressBar,
+	stats *pushStats,
+) (descriptor.Descriptor, error) {
+	// The chunk is no longer needed once pushed
+	if chunk.Path != "" {
+		defer os.Remove(chunk.Path)
 	}
 
-	if err := <-errCh; err != nil {
-		return nil, err
+	desc := descriptor.Descriptor{
+		MediaType:   mediaType,
+		Size:        chunk.Size,
+		Digest:      chunk.Digest,
+		Annotations: annotations,
 	}
 
-	return result, nil
+	// Skip the upload if the registry already has this blob
+	if blobExists(ctx, client, reference, desc) {
+		stats.existing.Add(1)
+
+		return desc, nil
+	}
+
+	chunkReader, err := chunk.Open()
+	if err != nil {
+		return descriptor.Descriptor{}, err
+	}
+	defer chunkReader.Close()
+
+	desc, err = client.BlobPut(ctx, reference, desc, progresshelper.NewReadSeeker(chunkReader, progressBar))
+	if err != nil {
+		return descriptor.Descriptor{}, err
+	}
+
+	stats.uploaded.Add(1)
+
+	return desc, nil
 }
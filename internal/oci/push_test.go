@@ -0,0 +1,119 @@
+package oci
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirruslabs/vetu/internal/randommac"
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/stretchr/testify/require"
+)
+
+const testDiskLayerSizeBytes = 1024 * 1024
+
+func TestPushReusesBaseAndExistingLayers(t *testing.T) {
+	t.Setenv("VETU_HOME", filepath.Join(t.TempDir(), ".vetu"))
+
+	ctx := context.Background()
+	client := regclient.New()
+	tempDir := t.TempDir()
+	opts := PushOptions{DiskLayerSizeBytes: testDiskLayerSizeBytes}
+
+	// Create a VM with a disk consisting of 4 windows
+	vmDir := createTestVM(t, 4*testDiskLayerSizeBytes)
+
+	baseReference, err := ref.New(fmt.Sprintf("ocidir://%s:base", filepath.Join(tempDir, "base")))
+	require.NoError(t, err)
+
+	_, err = PushVMDirectory(ctx, client, vmDir, baseReference, opts)
+	require.NoError(t, err)
+
+	// Change the contents of the second window only
+	diskFile, err := os.OpenFile(filepath.Join(vmDir.Path(), "disk.img"), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = diskFile.WriteAt([]byte("changed"), testDiskLayerSizeBytes+42)
+	require.NoError(t, err)
+	require.NoError(t, diskFile.Close())
+
+	// Push the changed VM to a different repository using the first push as a base,
+	// the unchanged windows should be copied from the base image without compressing them
+	reference, err := ref.New(fmt.Sprintf("ocidir://%s:latest", filepath.Join(tempDir, "target")))
+	require.NoError(t, err)
+
+	base, err := loadBaseImage(ctx, client, baseReference)
+	require.NoError(t, err)
+
+	stats := pushTestDisk(t, client, reference, vmDir, base, opts)
+	require.EqualValues(t, 3, stats.reused.Load())
+	require.EqualValues(t, 1, stats.uploaded.Load())
+	require.EqualValues(t, 0, stats.existing.Load())
+
+	// Pushing the same disk again without a base should find
+	// all of the disk layers in the repository and upload nothing
+	stats = pushTestDisk(t, client, reference, vmDir, nil, opts)
+	require.EqualValues(t, 0, stats.reused.Load())
+	require.EqualValues(t, 0, stats.uploaded.Load())
+	require.EqualValues(t, 4, stats.existing.Load())
+
+	// Disk layers reused from the base image should
+	// only be reused for the same compression
+	opts.Compression.Algorithm = "zstd"
+
+	stats = pushTestDisk(t, client, reference, vmDir, base, opts)
+	require.EqualValues(t, 0, stats.reused.Load())
+	require.EqualValues(t, 4, stats.uploaded.Load())
+}
+
+func createTestVM(t *testing.T, diskSize int64) *vmdirectory.VMDirectory {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(vmDir.KernelPath(), []byte("kernel"), 0600))
+
+	diskBytes := make([]byte, diskSize)
+	_, err = cryptorand.Read(diskBytes)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(vmDir.Path(), "disk.img"), diskBytes, 0600))
+
+	vmConfig := vmconfig.New()
+	vmConfig.MACAddress.HardwareAddr, err = randommac.UnicastAndLocallyAdministered()
+	require.NoError(t, err)
+	vmConfig.Disks = []vmconfig.Disk{{Name: "disk.img"}}
+	require.NoError(t, vmDir.SetConfig(vmConfig))
+
+	return vmDir
+}
+
+func pushTestDisk(
+	t *testing.T,
+	client *regclient.RegClient,
+	reference ref.Ref,
+	vmDir *vmdirectory.VMDirectory,
+	base *baseImage,
+	opts PushOptions,
+) *pushStats {
+	var stats pushStats
+
+	opts.Concurrency = 2
+
+	descriptors, err := pushDisk(context.Background(), client, reference,
+		filepath.Join(vmDir.Path(), "disk.img"), "disk.img", t.TempDir(), base, opts, &stats)
+	require.NoError(t, err)
+	require.Len(t, descriptors, 4)
+
+	// All of the disk layers should be available in the repository,
+	// regardless of whether they were uploaded or reused
+	for _, desc := range descriptors {
+		require.True(t, blobExists(context.Background(), client, reference, desc))
+	}
+
+	return &stats
+}
@@ -0,0 +1,188 @@
+// Package ociarchive packs and unpacks OCI image-layout directories
+// (index.json, oci-layout and blobs/) to and from tar archives,
+// optionally compressed with zstd.
+package ociarchive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrInvalidArchive = errors.New("invalid OCI archive")
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Create writes the contents of the OCI image-layout directory dir
+// to w as a tar archive, compressing it with zstd if requested.
+func Create(w io.Writer, dir string, compress bool) error {
+	if compress {
+		zstdWriter, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+
+		if err := create(zstdWriter, dir); err != nil {
+			_ = zstdWriter.Close()
+
+			return err
+		}
+
+		return zstdWriter.Close()
+	}
+
+	return create(w, dir)
+}
+
+// Extract unpacks a tar archive (optionally compressed with zstd,
+// which is detected automatically) into the directory dir.
+func Extract(r io.Reader, dir string) error {
+	bufReader := bufio.NewReader(r)
+
+	magic, err := bufReader.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if bytes.Equal(magic, zstdMagic) {
+		zstdReader, err := zstd.NewReader(bufReader)
+		if err != nil {
+			return err
+		}
+		defer zstdReader.Close()
+
+		return extract(zstdReader, dir)
+	}
+
+	return extract(bufReader, dir)
+}
+
+// IsCompressedName returns true if the archive name
+// suggests that the archive should be zstd-compressed.
+func IsCompressedName(name string) bool {
+	return strings.HasSuffix(name, ".zst") || strings.HasSuffix(name, ".tzst")
+}
+
+func create(w io.Writer, dir string) error {
+	tarWriter := tar.NewWriter(w)
+
+	if err := filepath.WalkDir(dir, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+
+		// OCI image layouts only consist of directories and regular files
+		if !fileInfo.IsDir() && !fileInfo.Mode().IsRegular() {
+			return fmt.Errorf("%w: %s is neither a directory nor a regular file", ErrInvalidArchive, relPath)
+		}
+
+		header, err := tar.FileInfoHeader(fileInfo, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if fileInfo.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tarWriter, file)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+func extract(r io.Reader, dir string) error {
+	tarReader := tar.NewReader(r)
+
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		// Prevent path traversal
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("%w: entry %q points outside of the archive", ErrInvalidArchive, header.Name)
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			if err := extractFile(tarReader, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: entry %q is neither a directory nor a regular file",
+				ErrInvalidArchive, header.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
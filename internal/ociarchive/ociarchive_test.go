@@ -0,0 +1,54 @@
+package ociarchive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirruslabs/vetu/internal/ociarchive"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		srcDir := t.TempDir()
+
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, "index.json"), []byte("{}"), 0600))
+		require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "blobs", "sha256"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, "blobs", "sha256", "abc"),
+			[]byte("Hello, World!\n"), 0600))
+
+		var buf bytes.Buffer
+
+		require.NoError(t, ociarchive.Create(&buf, srcDir, compress))
+
+		dstDir := t.TempDir()
+
+		require.NoError(t, ociarchive.Extract(&buf, dstDir))
+
+		indexBytes, err := os.ReadFile(filepath.Join(dstDir, "index.json"))
+		require.NoError(t, err)
+		require.Equal(t, "{}", string(indexBytes))
+
+		blobBytes, err := os.ReadFile(filepath.Join(dstDir, "blobs", "sha256", "abc"))
+		require.NoError(t, err)
+		require.Equal(t, "Hello, World!\n", string(blobBytes))
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     "../evil",
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+	}))
+	require.NoError(t, tarWriter.Close())
+
+	err := ociarchive.Extract(&buf, t.TempDir())
+	require.ErrorIs(t, err, ociarchive.ErrInvalidArchive)
+}
@@ -0,0 +1,136 @@
+package outputformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const FilterUsage = "only display the entries whose field has the specified value " +
+	"(e.g. --filter state=running), can be repeated multiple times to match all of the filters"
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+type filter struct {
+	key   string
+	value string
+}
+
+// Filter returns the values whose fields match all the "key=value" filters, where
+// key is the name of the field in the value's JSON representation (e.g. "state").
+func Filter[T any](values []T, rawFilters []string) ([]T, error) {
+	if len(rawFilters) == 0 {
+		return values, nil
+	}
+
+	knownKeys := jsonKeys(reflect.TypeFor[T]())
+
+	var filters []filter
+
+	for _, rawFilter := range rawFilters {
+		key, value, ok := strings.Cut(rawFilter, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w %q, expected the key=value format", ErrInvalidFilter, rawFilter)
+		}
+
+		if !slices.Contains(knownKeys, key) {
+			return nil, fmt.Errorf("%w %q, supported keys are: %s", ErrInvalidFilter, rawFilter,
+				strings.Join(knownKeys, ", "))
+		}
+
+		filters = append(filters, filter{key: key, value: value})
+	}
+
+	var result []T
+
+	for _, value := range values {
+		fields, err := jsonFields(value)
+		if err != nil {
+			return nil, err
+		}
+
+		matches := true
+
+		for _, filter := range filters {
+			if fields[filter.key] != filter.value {
+				matches = false
+
+				break
+			}
+		}
+
+		if matches {
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
+}
+
+// jsonFields returns the top-level scalar fields of the value's JSON
+// representation, with the omitted and the null fields being empty strings.
+func jsonFields(value any) (map[string]string, error) {
+	valueJSONBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(valueJSONBytes))
+
+	// Keep the numbers as they're represented in JSON (e.g. "8589934592" instead of "8.589934592e+09")
+	decoder.UseNumber()
+
+	var fields map[string]any
+
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+
+	for key, value := range fields {
+		if value == nil {
+			continue
+		}
+
+		result[key] = fmt.Sprint(value)
+	}
+
+	return result, nil
+}
+
+func jsonKeys(typ reflect.Type) []string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var result []string
+
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		result = append(result, name)
+	}
+
+	return result
+}
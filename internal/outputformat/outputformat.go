@@ -0,0 +1,152 @@
+// Package outputformat implements the --format and --filter command-line
+// flags that allow displaying the command's output in a machine-readable form.
+package outputformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Text = "text"
+	JSON = "json"
+	YAML = "yaml"
+)
+
+const Usage = "output format: text, json, yaml or a Go template (e.g. --format '{{.Name}}')"
+
+var ErrUnsupported = errors.New("unsupported output format")
+
+type Format struct {
+	name     string
+	template *template.Template
+}
+
+func Parse(value string) (*Format, error) {
+	switch value {
+	case Text, JSON, YAML:
+		return &Format{name: value}, nil
+	}
+
+	if !strings.Contains(value, "{{") {
+		return nil, fmt.Errorf("%w %q, supported formats are: text, json, yaml or a Go template",
+			ErrUnsupported, value)
+	}
+
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(value any) (string, error) {
+			valueBytes, err := json.Marshal(value)
+
+			return string(valueBytes), err
+		},
+	}).Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the template: %v", ErrUnsupported, err)
+	}
+
+	return &Format{name: "template", template: tmpl}, nil
+}
+
+// IsText returns true if the human-readable output was requested,
+// which is produced by the commands themselves.
+func (format *Format) IsText() bool {
+	return format.name == Text
+}
+
+// Print prints a single value in JSON, YAML or using the template.
+func (format *Format) Print(w io.Writer, value any) error {
+	switch format.name {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(value)
+	case YAML:
+		return printYAML(w, value)
+	case Text:
+		return fmt.Errorf("%w: text output should be produced by the command", ErrUnsupported)
+	default:
+		if err := format.template.Execute(w, value); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintln(w)
+
+		return err
+	}
+}
+
+// PrintList prints the values as a single array in JSON and YAML,
+// and executes the template for each of the values otherwise.
+func PrintList[T any](w io.Writer, format *Format, values []T) error {
+	if format.template == nil {
+		// Print an empty array instead of null
+		if values == nil {
+			values = []T{}
+		}
+
+		return format.Print(w, values)
+	}
+
+	for _, value := range values {
+		if err := format.Print(w, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printYAML prints the value's JSON representation as YAML
+// to use the same field names and value representations
+// without annotating every structure with YAML tags.
+func printYAML(w io.Writer, value any) error {
+	valueJSONBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// JSON is a subset of YAML, and unlike decoding into a map,
+	// decoding into a node preserves the order of the fields
+	var node yaml.Node
+
+	if err := yaml.Unmarshal(valueJSONBytes, &node); err != nil {
+		return err
+	}
+
+	resetStyle(&node)
+
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+// resetStyle switches the nodes decoded from JSON
+// from the flow style to the YAML's default block style.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
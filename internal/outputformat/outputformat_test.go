@@ -0,0 +1,109 @@
+package outputformat_test
+
+import (
+	"bytes"
+	"github.com/cirruslabs/vetu/internal/outputformat"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type vm struct {
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Tag        string `json:"tag,omitempty"`
+	MemorySize uint64 `json:"memorySize"`
+}
+
+var vms = []vm{
+	{Name: "first", State: "running", Tag: "true", MemorySize: 8 * 1024 * 1024 * 1024},
+	{Name: "second", State: "stopped"},
+}
+
+func TestJSON(t *testing.T) {
+	format, err := outputformat.Parse("json")
+	require.NoError(t, err)
+	require.False(t, format.IsText())
+
+	var buf bytes.Buffer
+
+	require.NoError(t, outputformat.PrintList(&buf, format, vms))
+	require.JSONEq(t, `[{"name":"first","state":"running","tag":"true","memorySize":8589934592},
+{"name":"second","state":"stopped","memorySize":0}]`, buf.String())
+
+	// Empty lists should be printed as an empty array
+	buf.Reset()
+
+	require.NoError(t, outputformat.PrintList[vm](&buf, format, nil))
+	require.JSONEq(t, `[]`, buf.String())
+}
+
+func TestYAML(t *testing.T) {
+	format, err := outputformat.Parse("yaml")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, outputformat.PrintList(&buf, format, vms))
+
+	// Field order should be preserved and strings
+	// that look like other types should be quoted
+	require.Equal(t, `- name: first
+  state: running
+  tag: "true"
+  memorySize: 8589934592
+- name: second
+  state: stopped
+  memorySize: 0
+`, buf.String())
+}
+
+func TestTemplate(t *testing.T) {
+	format, err := outputformat.Parse("{{.Name}} {{.State}}")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, outputformat.PrintList(&buf, format, vms))
+	require.Equal(t, "first running\nsecond stopped\n", buf.String())
+
+	format, err = outputformat.Parse("{{json .Name}}")
+	require.NoError(t, err)
+
+	buf.Reset()
+
+	require.NoError(t, format.Print(&buf, vms[0]))
+	require.Equal(t, "\"first\"\n", buf.String())
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := outputformat.Parse("xml")
+	require.ErrorIs(t, err, outputformat.ErrUnsupported)
+
+	_, err = outputformat.Parse("{{.Name")
+	require.ErrorIs(t, err, outputformat.ErrUnsupported)
+}
+
+func TestFilter(t *testing.T) {
+	filtered, err := outputformat.Filter(vms, []string{"state=running"})
+	require.NoError(t, err)
+	require.Equal(t, []vm{vms[0]}, filtered)
+
+	filtered, err = outputformat.Filter(vms, []string{"memorySize=8589934592", "name=first"})
+	require.NoError(t, err)
+	require.Equal(t, []vm{vms[0]}, filtered)
+
+	// Omitted fields should match the empty value
+	filtered, err = outputformat.Filter(vms, []string{"tag="})
+	require.NoError(t, err)
+	require.Equal(t, []vm{vms[1]}, filtered)
+
+	filtered, err = outputformat.Filter(vms, []string{"state=running", "name=second"})
+	require.NoError(t, err)
+	require.Empty(t, filtered)
+
+	_, err = outputformat.Filter(vms, []string{"state"})
+	require.ErrorIs(t, err, outputformat.ErrInvalidFilter)
+
+	_, err = outputformat.Filter(vms, []string{"color=red"})
+	require.ErrorIs(t, err, outputformat.ErrInvalidFilter)
+}
@@ -1,6 +1,7 @@
 package progresshelper
 
 import (
+	"io"
 	"os"
 	"time"
 
@@ -33,3 +34,26 @@ func applyNonTerminalOpts(progressBar *progressbar.ProgressBar) {
 
 	progressbar.OptionThrottle(nonTerminalThrottleDuration)(progressBar)
 }
+
+// NewReadSeeker is similar to progressbar.NewReader(), but keeps the
+// io.Seeker implementation around so that the reader can be rewound
+// (e.g. by github.com/regclient/regclient when retrying the upload).
+func NewReadSeeker(readSeeker io.ReadSeeker, progressBar *progressbar.ProgressBar) io.ReadSeeker {
+	return &progressReadSeeker{
+		ReadSeeker:  readSeeker,
+		progressBar: progressBar,
+	}
+}
+
+type progressReadSeeker struct {
+	io.ReadSeeker
+	progressBar *progressbar.ProgressBar
+}
+
+func (prs *progressReadSeeker) Read(p []byte) (int, error) {
+	n, err := prs.ReadSeeker.Read(p)
+
+	_ = prs.progressBar.Add(n)
+
+	return n, err
+}
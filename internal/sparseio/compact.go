@@ -0,0 +1,5 @@
+package sparseio
+
+import "errors"
+
+var ErrUnsupported = errors.New("hole punching is not supported by the file system")
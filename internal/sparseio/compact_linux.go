@@ -0,0 +1,122 @@
+package sparseio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const compactChunkSize = 1024 * 1024
+
+// Compact deallocates the file's blocks that only contain zeroes,
+// without changing the file's contents or size.
+func Compact(file *os.File) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var stat unix.Stat_t
+
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return err
+	}
+
+	compactor := &compactor{
+		file:       file,
+		blockSize:  int(stat.Blksize),
+		chunk:      make([]byte, compactChunkSize),
+		zeroBlock:  make([]byte, stat.Blksize),
+		zeroesFrom: -1,
+	}
+
+	var offset int64
+
+	for offset < fileInfo.Size() {
+		// Only scan the regions that are actually allocated
+		dataOffset, err := file.Seek(offset, unix.SEEK_DATA)
+		if err != nil {
+			// No more data till the end of the file
+			if errors.Is(err, unix.ENXIO) {
+				break
+			}
+
+			return err
+		}
+
+		holeOffset, err := file.Seek(dataOffset, unix.SEEK_HOLE)
+		if err != nil {
+			return err
+		}
+
+		if err := compactor.compactRegion(dataOffset, holeOffset); err != nil {
+			return err
+		}
+
+		offset = holeOffset
+	}
+
+	return nil
+}
+
+type compactor struct {
+	file       *os.File
+	blockSize  int
+	chunk      []byte
+	zeroBlock  []byte
+	zeroesFrom int64
+}
+
+func (compactor *compactor) compactRegion(start int64, end int64) error {
+	for offset := start; offset < end; {
+		n, err := compactor.file.ReadAt(compactor.chunk[:min(int64(len(compactor.chunk)), end-offset)], offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		for blockStart := 0; blockStart < n; blockStart += compactor.blockSize {
+			blockEnd := min(blockStart+compactor.blockSize, n)
+			blockOffset := offset + int64(blockStart)
+
+			if bytes.Equal(compactor.chunk[blockStart:blockEnd], compactor.zeroBlock[:blockEnd-blockStart]) {
+				if compactor.zeroesFrom == -1 {
+					compactor.zeroesFrom = blockOffset
+				}
+
+				continue
+			}
+
+			if err := compactor.flush(blockOffset); err != nil {
+				return err
+			}
+		}
+
+		offset += int64(n)
+	}
+
+	return compactor.flush(end)
+}
+
+// flush deallocates the run of zeroed blocks that ends at the specified offset (if any).
+func (compactor *compactor) flush(end int64) error {
+	if compactor.zeroesFrom == -1 {
+		return nil
+	}
+
+	start := compactor.zeroesFrom
+	compactor.zeroesFrom = -1
+
+	err := unix.Fallocate(int(compactor.file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE,
+		start, end-start)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return ErrUnsupported
+	}
+
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package sparseio
+
+import "os"
+
+func Compact(file *os.File) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,20 @@
+package sparseio
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// PunchHole deallocates the specified range of the file, so that it reads
+// back as zeroes, without changing the file's size.
+func PunchHole(file *os.File, offset int64, length int64) error {
+	err := unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, length)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		// Fall back to zeroing the range if the file system doesn't support hole punching
+		return writeZeroes(file, offset, length)
+	}
+
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package sparseio
+
+import "os"
+
+func PunchHole(file *os.File, offset int64, length int64) error {
+	return writeZeroes(file, offset, length)
+}
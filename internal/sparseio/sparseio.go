@@ -39,3 +39,20 @@ func Copy(dst io.WriterAt, src io.Reader) error {
 		offset += int64(n)
 	}
 }
+
+func writeZeroes(dst io.WriterAt, offset int64, length int64) error {
+	zeroedChunk := make([]byte, blockSize)
+
+	for length > 0 {
+		n := min(length, blockSize)
+
+		if _, err := dst.WriteAt(zeroedChunk[:n], offset); err != nil {
+			return err
+		}
+
+		offset += n
+		length -= n
+	}
+
+	return nil
+}
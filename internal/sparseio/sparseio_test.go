@@ -1,11 +1,14 @@
 package sparseio_test
 
 import (
+	"bytes"
 	cryptorand "crypto/rand"
+	"errors"
 	"github.com/cirruslabs/vetu/internal/sparseio"
 	"github.com/dustin/go-humanize"
 	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -78,6 +81,64 @@ func copySparse(t *testing.T, originalFilePath string, sparseFilePath string) {
 	require.NoError(t, sparseFile.Close())
 }
 
+func TestPunchHole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+
+	data := bytes.Repeat([]byte{0xFF}, 256*1024)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	require.NoError(t, err)
+	require.NoError(t, sparseio.PunchHole(file, 64*1024, 128*1024))
+	require.NoError(t, file.Close())
+
+	// Only the specified range should be zeroed
+	copy(data[64*1024:192*1024], make([]byte, 128*1024))
+
+	actualData, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, actualData)
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+
+	// Create a fully allocated file with interleaved
+	// non-zero and zeroed parts (including an unaligned tail)
+	var data []byte
+
+	for i := range 16 {
+		if i%2 == 0 {
+			data = append(data, bytes.Repeat([]byte{0xFF}, 1024*1024)...)
+		} else {
+			data = append(data, make([]byte, 1024*1024)...)
+		}
+	}
+
+	data = append(data, make([]byte, 1000)...)
+
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	allocatedBefore := allocatedSize(t, path)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	require.NoError(t, err)
+
+	err = sparseio.Compact(file)
+	if errors.Is(err, sparseio.ErrUnsupported) {
+		t.Skip("hole punching is not supported on this file system")
+	}
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// Contents should stay the same, but the zeroed parts should be deallocated
+	actualData, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, actualData)
+
+	require.LessOrEqual(t, allocatedSize(t, path), allocatedBefore-8*1024*1024)
+}
+
 //nolint:gosec // we don't need cryptographically secure randomness here
 func randomlySizedChunk(minBytes int, maxBytes int) []byte {
 	return make([]byte, rand.Intn(maxBytes-minBytes+1)+minBytes)
@@ -94,3 +155,11 @@ func fileDigest(t *testing.T, path string) digest.Digest {
 
 	return digest
 }
+
+func allocatedSize(t *testing.T, path string) int64 {
+	var stat unix.Stat_t
+
+	require.NoError(t, unix.Stat(path, &stat))
+
+	return stat.Blocks * 512
+}
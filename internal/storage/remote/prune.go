@@ -0,0 +1,270 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/vetu/internal/diskusage"
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/globallock"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/dustin/go-humanize"
+	"github.com/opencontainers/go-digest"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+const cacheLimitEnv = "VETU_CACHE_LIMIT"
+
+type Entry struct {
+	Name  string
+	VMDir *vmdirectory.VMDirectory
+
+	// Size is the disk space occupied by the VM image, including
+	// the extents that it shares with the other VM images
+	Size uint64
+
+	// Freed is the disk space that was freed by evicting the VM image,
+	// which excludes the extents still shared with the remaining VM
+	// images, only set for the entries returned by Prune()
+	Freed uint64
+
+	LastAccessed time.Time
+}
+
+// CacheLimit returns the OCI cache size limit configured
+// via the VETU_CACHE_LIMIT environment variable (e.g. "200GB").
+func CacheLimit() (uint64, bool, error) {
+	value, ok := os.LookupEnv(cacheLimitEnv)
+	if !ok || value == "" {
+		return 0, false, nil
+	}
+
+	limit, err := humanize.ParseBytes(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse %s: %w", cacheLimitEnv, err)
+	}
+
+	return limit, true, nil
+}
+
+// Entries returns the VM images in the OCI cache (one per digest directory),
+// ordered from the least recently used to the most recently used.
+func Entries() ([]Entry, error) {
+	baseDir, err := initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+
+	if err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if _, err := digest.Parse(d.Name()); err != nil {
+			return nil
+		}
+
+		name, err := filepath.Rel(baseDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		vmDir, err := vmdirectory.Load(path)
+		if err != nil {
+			return err
+		}
+
+		diskUsage, err := vmDir.DiskUsage()
+		if err != nil {
+			return err
+		}
+
+		lastAccessed, err := vmDir.LastAccessed()
+		if err != nil {
+			return err
+		}
+
+		result = append(result, Entry{
+			Name:         nameFromCachePath(name) + "@" + d.Name(),
+			VMDir:        vmDir,
+			Size:         diskUsage.Allocated,
+			LastAccessed: lastAccessed,
+		})
+
+		return filepath.SkipDir
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastAccessed.Before(result[j].LastAccessed)
+	})
+
+	return result, nil
+}
+
+// Prune evicts the least recently used VM images from the OCI cache
+// until its size fits into the limit and returns the evicted VM images.
+//
+// VM images that are locked (for example, because they're being cloned)
+// are never evicted. When dryRun is true, nothing is actually removed.
+//
+// Should be called under a global lock.
+func Prune(limit uint64, dryRun bool) ([]Entry, error) {
+	entries, err := Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	// VM images pulled from the same base share the disk extents,
+	// so the OCI cache size is smaller than the sum of their sizes
+	total, err := allocatedSize(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := slices.Clone(entries)
+
+	var result []Entry
+
+	for _, entry := range entries {
+		if total <= limit {
+			break
+		}
+
+		evicted, err := evict(entry, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		if !evicted {
+			continue
+		}
+
+		remaining = slices.DeleteFunc(remaining, func(remainingEntry Entry) bool {
+			return remainingEntry.VMDir.Path() == entry.VMDir.Path()
+		})
+
+		// Evicting the VM image only frees the extents that
+		// are not shared with the remaining VM images
+		newTotal, err := allocatedSize(remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Freed = total - min(newTotal, total)
+		total = newTotal
+		result = append(result, entry)
+	}
+
+	// Remove the tags pointing to the evicted VM images
+	if len(result) != 0 && !dryRun {
+		if err := GC(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// EnforceCacheLimit prunes the OCI cache if VETU_CACHE_LIMIT is set,
+// but never evicts the VM image identified by the remote name.
+func EnforceCacheLimit(ctx context.Context, keep remotename.RemoteName) error {
+	limit, ok, err := CacheLimit()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	_, err = globallock.With(ctx, func() (struct{}, error) {
+		// Prevent the VM image that we were asked
+		// to keep from being evicted by locking it
+		vmDir, err := Open(keep)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		lock, err := vmDir.FileLock(filelock.LockShared)
+		if err != nil {
+			return struct{}{}, err
+		}
+		defer func() {
+			_ = lock.Close()
+		}()
+
+		// Failing to acquire the shared lock means that the VM image
+		// is already exclusively locked, so it won't be evicted anyway
+		if err := lock.Trylock(); err != nil && !errors.Is(err, filelock.ErrAlreadyLocked) {
+			return struct{}{}, err
+		}
+
+		evicted, err := Prune(limit, false)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		for _, entry := range evicted {
+			fmt.Printf("evicted %s (%s) from the OCI cache to stay within %s=%s...\n",
+				entry.Name, humanize.Bytes(entry.Freed), cacheLimitEnv, humanize.Bytes(limit))
+		}
+
+		return struct{}{}, nil
+	})
+
+	return err
+}
+
+// allocatedSize returns the disk space occupied by the VM images,
+// counting the extents shared between them only once.
+func allocatedSize(entries []Entry) (uint64, error) {
+	counter := diskusage.New()
+
+	for _, entry := range entries {
+		if err := counter.AddDir(entry.VMDir.Path()); err != nil {
+			return 0, err
+		}
+	}
+
+	return counter.Usage().Allocated, nil
+}
+
+func evict(entry Entry, dryRun bool) (bool, error) {
+	lock, err := entry.VMDir.FileLock(filelock.LockExclusive)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = lock.Close()
+	}()
+
+	if err := lock.Trylock(); err != nil {
+		if errors.Is(err, filelock.ErrAlreadyLocked) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if dryRun {
+		return true, nil
+	}
+
+	if err := os.RemoveAll(entry.VMDir.Path()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
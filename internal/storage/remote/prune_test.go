@@ -0,0 +1,143 @@
+package remote_test
+
+import (
+	"errors"
+	"github.com/cirruslabs/vetu/internal/filelock"
+	"github.com/cirruslabs/vetu/internal/name/remotename"
+	"github.com/cirruslabs/vetu/internal/storage/remote"
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/cirruslabs/vetu/internal/zerocopy"
+	"github.com/dustin/go-humanize"
+	"github.com/opencontainers/go-digest"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	t.Setenv("VETU_HOME", filepath.Join(t.TempDir(), ".vetu"))
+
+	now := time.Now()
+
+	oldest := createCacheEntry(t, "oldest", now.Add(-3*time.Hour))
+	locked := createCacheEntry(t, "locked", now.Add(-2*time.Hour))
+	newest := createCacheEntry(t, "newest", now.Add(-time.Hour))
+
+	// Lock the VM image as if it was being cloned
+	lockedVMDir, err := remote.Open(locked)
+	require.NoError(t, err)
+
+	lock, err := lockedVMDir.FileLock(filelock.LockShared)
+	require.NoError(t, err)
+	require.NoError(t, lock.Trylock())
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	// Each VM image occupies a bit more than 1 MB, so only the two
+	// of them fit into the 2.5 MB limit, and since the locked one
+	// cannot be evicted, only the least recently used one is
+	limit := 2*humanize.MByte + humanize.MByte/2
+
+	evicted, err := remote.Prune(uint64(limit), true)
+	require.NoError(t, err)
+	require.Equal(t, []string{oldest.String()}, entryNames(evicted))
+	require.GreaterOrEqual(t, evicted[0].Freed, uint64(humanize.MByte))
+
+	// Dry-run shouldn't evict anything
+	require.True(t, remote.Exists(oldest))
+
+	evicted, err = remote.Prune(uint64(limit), false)
+	require.NoError(t, err)
+	require.Equal(t, []string{oldest.String()}, entryNames(evicted))
+
+	require.False(t, remote.Exists(oldest))
+	require.True(t, remote.Exists(locked))
+	require.True(t, remote.Exists(newest))
+}
+
+func TestPruneSharedExtents(t *testing.T) {
+	t.Setenv("VETU_HOME", filepath.Join(t.TempDir(), ".vetu"))
+
+	now := time.Now()
+
+	base := createCacheEntry(t, "base", now.Add(-2*time.Hour))
+
+	baseVMDir, err := remote.Open(base)
+	require.NoError(t, err)
+
+	// Clone the base VM image's disk, as if the derived
+	// VM image was pulled with the base VM image's layers
+	derivedVMDir, err := temporary.Create()
+	require.NoError(t, err)
+	require.NoError(t, derivedVMDir.SetConfig(vmconfig.New()))
+
+	baseDisk, err := os.Open(filepath.Join(baseVMDir.Path(), "disk.img"))
+	require.NoError(t, err)
+	defer baseDisk.Close()
+
+	derivedDisk, err := os.Create(filepath.Join(derivedVMDir.Path(), "disk.img"))
+	require.NoError(t, err)
+	defer derivedDisk.Close()
+
+	if err := zerocopy.Clone(int(derivedDisk.Fd()), int(baseDisk.Fd())); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) {
+			t.Skipf("file system doesn't support cloning: %v", err)
+		}
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, derivedVMDir.SetLastAccessed(now.Add(-time.Hour)))
+
+	derived, err := remotename.NewFromString("example.com/vm@" + digest.FromString("derived").String())
+	require.NoError(t, err)
+	require.NoError(t, remote.MoveIn(derived, derived.Digest, derivedVMDir))
+
+	// Both VM images fit into the 1.5 MB limit because their disks
+	// share the extents, even though the sum of their sizes doesn't
+	limit := humanize.MByte + humanize.MByte/2
+
+	evicted, err := remote.Prune(uint64(limit), true)
+	require.NoError(t, err)
+	require.Empty(t, evicted)
+
+	// Evicting the base VM image only frees the extents that
+	// are not shared with the derived VM image
+	evicted, err = remote.Prune(humanize.MByte/2, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{base.String(), derived.String()}, entryNames(evicted))
+	require.Less(t, evicted[0].Freed, uint64(humanize.MByte))
+	require.GreaterOrEqual(t, evicted[1].Freed, uint64(humanize.MByte))
+}
+
+func createCacheEntry(t *testing.T, tag string, lastAccessed time.Time) remotename.RemoteName {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	require.NoError(t, vmDir.SetConfig(vmconfig.New()))
+	require.NoError(t, os.WriteFile(filepath.Join(vmDir.Path(), "disk.img"),
+		make([]byte, humanize.MByte), 0600))
+	require.NoError(t, vmDir.SetLastAccessed(lastAccessed))
+
+	taggedName, err := remotename.NewFromString("example.com/vm:" + tag)
+	require.NoError(t, err)
+
+	digestedName := taggedName
+	digestedName.Tag = ""
+	digestedName.Digest = digest.FromString(tag)
+
+	require.NoError(t, remote.MoveIn(taggedName, digestedName.Digest, vmDir))
+
+	return digestedName
+}
+
+func entryNames(entries []remote.Entry) []string {
+	return lo.Map(entries, func(entry remote.Entry, _ int) string {
+		return entry.Name
+	})
+}
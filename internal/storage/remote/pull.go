@@ -9,8 +9,11 @@ import (
 	"github.com/cirruslabs/vetu/internal/name/remotename"
 	"github.com/cirruslabs/vetu/internal/oci"
 	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/version"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/ref"
+	"time"
 )
 
 func Pull(ctx context.Context, remoteName remotename.RemoteName, insecure bool, concurrency int) error {
@@ -20,15 +23,6 @@ func Pull(ctx context.Context, remoteName remotename.RemoteName, insecure bool,
 		return err
 	}
 
-	// Initialize a temporary directory to which we'll first pull the VM image
-	vmDir, lock, err := temporary.CreateTryLocked()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = lock.Unlock()
-	}()
-
 	// Lock the registry
 	registryLock, err := RegistryLock(remoteName)
 	if err != nil {
@@ -62,26 +56,65 @@ func Pull(ctx context.Context, remoteName remotename.RemoteName, insecure bool,
 
 	fmt.Println("pulling manifest...")
 
-	manifest, err := client.ManifestGet(ctx, reference)
+	manifest, resolvedDigest, err := oci.ResolveManifest(ctx, client, reference)
 	if err != nil {
 		return err
 	}
 
+	if resolvedDigest != manifest.GetDescriptor().Digest {
+		fmt.Printf("selected VM image %s for platform %s from the image index...\n",
+			manifest.GetDescriptor().Digest, oci.Platform())
+	}
+
 	// Make the remote name that we've got from the user fully qualified
-	// by stripping the tag and setting its digest to the manifest's digest
+	// by stripping the tag and setting its digest to the resolved digest,
+	// which is the image index's digest in case of multi-platform VM images
 	fullyQualifiedRemoteName := remoteName
 	fullyQualifiedRemoteName.Tag = ""
-	fullyQualifiedRemoteName.Digest = manifest.GetDescriptor().Digest
+	fullyQualifiedRemoteName.Digest = resolvedDigest
 
 	// Pull the VM image if we don't have one already in cache
 	if !Exists(fullyQualifiedRemoteName) {
-		if err := oci.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency); err != nil {
+		// Initialize a temporary directory to which we'll first pull the VM image,
+		// it's identified by the manifest's digest to be able to resume the pull
+		// in case it's interrupted
+		vmDir, lock, err := temporary.CreateResumableTryLocked(manifest.GetDescriptor().Digest.Encoded())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = lock.Unlock()
+		}()
+
+		// Disk layers of the VM images that are already in the OCI cache
+		// can be copied locally instead of pulling them from the registry
+		localVMDirs, err := VMDirs()
+		if err != nil {
+			return err
+		}
+
+		if err := oci.PullVMDirectory(ctx, client, reference, manifest, vmDir, concurrency, localVMDirs); err != nil {
+			return err
+		}
+
+		// Record where this VM image came from
+		if err := vmDir.SetOrigin(&vmdirectory.Origin{
+			RemoteName:  remoteName.String(),
+			Digest:      resolvedDigest,
+			PullTime:    time.Now(),
+			VetuVersion: version.FullVersion,
+		}); err != nil {
 			return err
 		}
 
 		// We've successfully pulled the VM image, we can now atomically move
 		// the temporary directory containing it to its final destination
-		return MoveIn(remoteName, manifest.GetDescriptor().Digest, vmDir)
+		if err := MoveIn(remoteName, resolvedDigest, vmDir); err != nil {
+			return err
+		}
+
+		// The OCI cache has grown, so make sure it still fits into the limit
+		return EnforceCacheLimit(ctx, fullyQualifiedRemoteName)
 	} else {
 		fmt.Printf("skipping pull because %s already exists in the OCI cache...\n",
 			fullyQualifiedRemoteName)
@@ -113,14 +113,14 @@ func List() ([]lo.Tuple2[string, *vmdirectory.VMDirectory], error) {
 				return err
 			}
 
-			result = append(result, lo.T2(name+":"+d.Name(), vmDir))
+			result = append(result, lo.T2(nameFromCachePath(name)+":"+d.Name(), vmDir))
 		} else if _, err := digest.Parse(d.Name()); err == nil {
 			vmDir, err := vmdirectory.Load(path)
 			if err != nil {
 				return err
 			}
 
-			result = append(result, lo.T2(name+"@"+d.Name(), vmDir))
+			result = append(result, lo.T2(nameFromCachePath(name)+"@"+d.Name(), vmDir))
 		}
 
 		return nil
@@ -131,6 +131,32 @@ func List() ([]lo.Tuple2[string, *vmdirectory.VMDirectory], error) {
 	return result, nil
 }
 
+// VMDirs returns the VM directories from the OCI cache,
+// without the duplicates caused by the tag symbolic links.
+func VMDirs() ([]*vmdirectory.VMDirectory, error) {
+	vmDirs, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.UniqBy(lo.Map(vmDirs, func(item lo.Tuple2[string, *vmdirectory.VMDirectory], index int) *vmdirectory.VMDirectory {
+		return item.B
+	}), func(vmDir *vmdirectory.VMDirectory) string {
+		return vmDir.Path()
+	}), nil
+}
+
+// nameFromCachePath converts a cache path relative to the base directory
+// (e.g. "ghcr.io/cirruslabs/ubuntu") into a name that can be passed back
+// to Vetu, which is only different for the OCI image-layout directories.
+func nameFromCachePath(relPath string) string {
+	if rest, ok := strings.CutPrefix(relPath, remotename.RegistryOCIDir+"/"); ok {
+		return remotename.OCIDirScheme + "/" + rest
+	}
+
+	return relPath
+}
+
 func Delete(name remotename.RemoteName) error {
 	path, err := PathForUnresolved(name)
 	if err != nil {
@@ -12,6 +12,13 @@ import (
 	"golang.org/x/sys/unix"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	resumablePrefix = "resumable-"
+	resumableMaxAge = 7 * 24 * time.Hour
 )
 
 func CreateFrom(srcDir string) (*vmdirectory.VMDirectory, error) {
@@ -44,6 +51,12 @@ func CreateFrom(srcDir string) (*vmdirectory.VMDirectory, error) {
 	}
 
 	for _, dirEntry := range dirEntries {
+		// Skip the non-regular files (e.g. the API socket
+		// left by a "vetu run" that has crashed)
+		if !dirEntry.Type().IsRegular() {
+			continue
+		}
+
 		srcFile, err := os.Open(filepath.Join(srcDir, dirEntry.Name()))
 		if err != nil {
 			return nil, err
@@ -133,6 +146,77 @@ func CreateTryLocked() (*vmdirectory.VMDirectory, *filelock.FileLock, error) {
 	return vmDir, lock, nil
 }
 
+// CreateResumableTryLocked is similar to CreateTryLocked, but the VM directory
+// is identified by the key and survives the garbage collection for a while,
+// so that the operation that was interrupted can pick up where it left off.
+func CreateResumableTryLocked(key string) (*vmdirectory.VMDirectory, *filelock.FileLock, error) {
+	baseDir, err := initialize()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vmDirPath := filepath.Join(baseDir, resumablePrefix+key)
+
+	if err := os.MkdirAll(vmDirPath, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	// Postpone the garbage collection since we're about to use this directory
+	now := time.Now()
+
+	if err := os.Chtimes(vmDirPath, now, now); err != nil {
+		return nil, nil, err
+	}
+
+	lock, err := filelock.New(vmDirPath, filelock.LockExclusive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := lock.Trylock(); err != nil {
+		return nil, nil, err
+	}
+
+	vmDir, err := vmdirectory.Load(vmDirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := vmDir.Config(); err != nil {
+		if err := vmDir.SetConfig(vmconfig.New()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return vmDir, lock, nil
+}
+
+// CreateDirTryLocked creates an empty locked directory that is not a VM
+// directory, useful for scratch data like OCI image layouts.
+func CreateDirTryLocked() (string, *filelock.FileLock, error) {
+	baseDir, err := initialize()
+	if err != nil {
+		return "", nil, err
+	}
+
+	path := filepath.Join(baseDir, uuid.NewString())
+
+	if err := os.Mkdir(path, 0755); err != nil {
+		return "", nil, err
+	}
+
+	lock, err := filelock.New(path, filelock.LockExclusive)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := lock.Trylock(); err != nil {
+		return "", nil, err
+	}
+
+	return path, lock, nil
+}
+
 func GC() error {
 	baseDir, err := initialize()
 	if err != nil {
@@ -147,6 +231,22 @@ func GC() error {
 	for _, dirEntry := range dirEntries {
 		path := filepath.Join(baseDir, dirEntry.Name())
 
+		// Keep the resumable directories around for a while
+		if strings.HasPrefix(dirEntry.Name(), resumablePrefix) {
+			info, err := dirEntry.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+
+				return err
+			}
+
+			if time.Since(info.ModTime()) < resumableMaxAge {
+				continue
+			}
+		}
+
 		lock, err := filelock.New(path, filelock.LockExclusive)
 		if err != nil {
 			// It's quite possible that while iterating and removing the temporary directories,
@@ -42,6 +42,30 @@ func TestAtomicallyCopyThrough(t *testing.T) {
 	require.Equal(t, fileDigest(t, filepath.Join(dstVMDir.Path(), "binary.bin")), digest.FromBytes(buf))
 }
 
+func TestResumableSurvivesGC(t *testing.T) {
+	t.Setenv("VETU_HOME", filepath.Join(t.TempDir(), ".vetu"))
+
+	vmDir, lock, err := temporary.CreateResumableTryLocked("test")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(vmDir.Path(), "disk.img"), []byte("partial"), 0600))
+	require.NoError(t, lock.Unlock())
+
+	// Unlike the regular temporary directories,
+	// the unlocked resumable directory should be kept
+	require.NoError(t, temporary.GC())
+
+	vmDir, lock, err = temporary.CreateResumableTryLocked("test")
+	require.NoError(t, err)
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	diskBytes, err := os.ReadFile(filepath.Join(vmDir.Path(), "disk.img"))
+	require.NoError(t, err)
+	require.Equal(t, "partial", string(diskBytes))
+}
+
 func fileDigest(t *testing.T, path string) digest.Digest {
 	file, err := os.Open(path)
 	require.NoError(t, err)
@@ -0,0 +1,268 @@
+// Package vfio validates and prepares the host's PCI devices for the
+// direct device assignment[1] using the VFIO framework.
+//
+// [1]: https://github.com/cloud-hypervisor/cloud-hypervisor/blob/main/docs/vfio.md
+package vfio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrInvalidBDF      = errors.New("invalid PCI address")
+	ErrDeviceNotFound  = errors.New("PCI device not found")
+	ErrNotBound        = errors.New("PCI device is not bound to the vfio-pci driver")
+	ErrNoIOMMU         = errors.New("IOMMU is not available")
+	ErrGroupNotViable  = errors.New("IOMMU group is not viable")
+	ErrPermission      = errors.New("insufficient permissions to use VFIO")
+	ErrModuleNotLoaded = errors.New("vfio-pci kernel module is not loaded")
+)
+
+const Driver = "vfio-pci"
+
+// Paths are variables to be able to test against a fake sysfs and devfs
+var (
+	sysfsPath = "/sys"
+	devfsPath = "/dev"
+)
+
+// Drivers that don't prevent other devices in the same IOMMU group
+// from being assigned to the VM, in addition to the devices with
+// no driver at all.
+var viableDrivers = []string{Driver, "pci-stub", "pcieport"}
+
+var bdfRegexp = regexp.MustCompile(`^(?:([0-9a-f]{4}):)?([0-9a-f]{2}):([0-9a-f]{2})\.([0-7])$`)
+
+// ParseBDF parses the PCI address in the [DOMAIN:]BUS:DEVICE.FUNCTION format
+// (e.g. "0000:01:00.0" or "01:00.0") and returns it in the full format.
+func ParseBDF(value string) (string, error) {
+	matches := bdfRegexp.FindStringSubmatch(strings.ToLower(value))
+	if matches == nil {
+		return "", fmt.Errorf("%w: %q should be in the [DOMAIN:]BUS:DEVICE.FUNCTION format "+
+			"(e.g. 0000:01:00.0)", ErrInvalidBDF, value)
+	}
+
+	domain := matches[1]
+	if domain == "" {
+		domain = "0000"
+	}
+
+	return fmt.Sprintf("%s:%s:%s.%s", domain, matches[2], matches[3], matches[4]), nil
+}
+
+// DevicePath returns the device's sysfs directory, which
+// is what Cloud Hypervisor expects in the "--device path=".
+func DevicePath(bdf string) string {
+	return filepath.Join("/sys/bus/pci/devices", bdf) + "/"
+}
+
+// BDFFromPath returns the PCI address of the device's sysfs directory,
+// or false if the path doesn't point to a PCI device (e.g. to a mediated device).
+func BDFFromPath(path string) (string, bool) {
+	dir, base := filepath.Split(filepath.Clean(path))
+
+	if filepath.Clean(dir) != "/sys/bus/pci/devices" {
+		return "", false
+	}
+
+	bdf, err := ParseBDF(base)
+	if err != nil {
+		return "", false
+	}
+
+	return bdf, true
+}
+
+// Validate checks that the PCI device can be assigned to the VM, which
+// requires the device to be bound to the vfio-pci driver, its IOMMU group
+// to be viable and the group's VFIO device node to be accessible.
+func Validate(bdf string) error {
+	if err := checkExists(bdf); err != nil {
+		return err
+	}
+
+	driver, err := boundDriver(bdf)
+	if err != nil {
+		return err
+	}
+
+	if driver != Driver {
+		boundTo := "no driver"
+		if driver != "" {
+			boundTo = fmt.Sprintf("the %s driver", driver)
+		}
+
+		return fmt.Errorf("%w: device %s is bound to %s, use \"vetu device bind %s\" to rebind it",
+			ErrNotBound, bdf, boundTo, bdf)
+	}
+
+	group, err := iommuGroup(bdf)
+	if err != nil {
+		return err
+	}
+
+	if err := checkGroupViable(bdf, group); err != nil {
+		return err
+	}
+
+	for _, path := range []string{
+		filepath.Join(devfsPath, "vfio", "vfio"),
+		filepath.Join(devfsPath, "vfio", group),
+	} {
+		if err := unix.Access(path, unix.R_OK|unix.W_OK); err != nil {
+			return fmt.Errorf("%w: cannot access %s: %v, run vetu as root or grant the current user "+
+				"read and write access to it (e.g. using a udev rule)", ErrPermission, path, err)
+		}
+	}
+
+	return nil
+}
+
+// Bind rebinds the PCI device to the vfio-pci driver, unbinding
+// it from the current driver if needed. Returns the driver that
+// the device was bound to previously, if any.
+func Bind(bdf string) (string, error) {
+	if err := checkExists(bdf); err != nil {
+		return "", err
+	}
+
+	driver, err := boundDriver(bdf)
+	if err != nil {
+		return "", err
+	}
+
+	if driver == Driver {
+		return driver, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(sysfsPath, "bus", "pci", "drivers", Driver)); err != nil {
+		return "", fmt.Errorf("%w: run \"modprobe %s\" first", ErrModuleNotLoaded, Driver)
+	}
+
+	devicePath := filepath.Join(sysfsPath, "bus", "pci", "devices", bdf)
+
+	// Make sure that only the vfio-pci driver will
+	// be considered when probing for this device
+	if err := writeSysfs(filepath.Join(devicePath, "driver_override"), Driver); err != nil {
+		return "", err
+	}
+
+	if driver != "" {
+		if err := writeSysfs(filepath.Join(devicePath, "driver", "unbind"), bdf); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writeSysfs(filepath.Join(sysfsPath, "bus", "pci", "drivers_probe"), bdf); err != nil {
+		return "", err
+	}
+
+	newDriver, err := boundDriver(bdf)
+	if err != nil {
+		return "", err
+	}
+
+	if newDriver != Driver {
+		return "", fmt.Errorf("%w: device %s was not picked up by the %s driver, check the kernel log "+
+			"for details", ErrNotBound, bdf, Driver)
+	}
+
+	return driver, nil
+}
+
+func checkExists(bdf string) error {
+	if _, err := os.Stat(filepath.Join(sysfsPath, "bus", "pci", "devices", bdf)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: there's no device %s on this host, use \"lspci -D\" to list "+
+				"the available devices", ErrDeviceNotFound, bdf)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// boundDriver returns the driver that the PCI device
+// is bound to, or an empty string if there's none.
+func boundDriver(bdf string) (string, error) {
+	driverPath, err := os.Readlink(filepath.Join(sysfsPath, "bus", "pci", "devices", bdf, "driver"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return filepath.Base(driverPath), nil
+}
+
+func iommuGroup(bdf string) (string, error) {
+	groupPath, err := os.Readlink(filepath.Join(sysfsPath, "bus", "pci", "devices", bdf, "iommu_group"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: device %s has no IOMMU group, make sure that the IOMMU is enabled "+
+				"in the firmware settings and on the kernel command line (e.g. intel_iommu=on or "+
+				"amd_iommu=on)", ErrNoIOMMU, bdf)
+		}
+
+		return "", err
+	}
+
+	return filepath.Base(groupPath), nil
+}
+
+// checkGroupViable ensures that the other devices in the same IOMMU group are
+// not used by the host, otherwise the group cannot be used by the VM.
+func checkGroupViable(bdf string, group string) error {
+	entries, err := os.ReadDir(filepath.Join(sysfsPath, "kernel", "iommu_groups", group, "devices"))
+	if err != nil {
+		return err
+	}
+
+	var conflicts []string
+
+	for _, entry := range entries {
+		if entry.Name() == bdf {
+			continue
+		}
+
+		driver, err := boundDriver(entry.Name())
+		if err != nil {
+			return err
+		}
+
+		if driver != "" && !slices.Contains(viableDrivers, driver) {
+			conflicts = append(conflicts, fmt.Sprintf("%s (bound to %s)", entry.Name(), driver))
+		}
+	}
+
+	if len(conflicts) != 0 {
+		return fmt.Errorf("%w: IOMMU group %s of device %s also contains %s, bind them to the %s "+
+			"driver using \"vetu device bind\" too", ErrGroupNotViable, group, bdf,
+			strings.Join(conflicts, ", "), Driver)
+	}
+
+	return nil
+}
+
+func writeSysfs(path string, value string) error {
+	if err := os.WriteFile(path, []byte(value), 0); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w: failed to write to %s: %v, run vetu as root", ErrPermission, path, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package vfio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBDF(t *testing.T) {
+	bdf, err := ParseBDF("0000:01:00.0")
+	require.NoError(t, err)
+	require.Equal(t, "0000:01:00.0", bdf)
+
+	bdf, err = ParseBDF("0A:1F.7")
+	require.NoError(t, err)
+	require.Equal(t, "0000:0a:1f.7", bdf)
+
+	for _, invalid := range []string{"", "1:00.0", "01:00.8", "01:00", "/sys/bus/pci/devices/0000:01:00.0"} {
+		_, err := ParseBDF(invalid)
+		require.ErrorIs(t, err, ErrInvalidBDF, invalid)
+	}
+}
+
+func TestBDFFromPath(t *testing.T) {
+	bdf, ok := BDFFromPath(DevicePath("0000:01:00.0"))
+	require.True(t, ok)
+	require.Equal(t, "0000:01:00.0", bdf)
+
+	_, ok = BDFFromPath("/sys/bus/mdev/devices/c2e088c3-4e5a-4d8b-a2d3-7e4b9c4e2f10/")
+	require.False(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	fakeHost(t)
+
+	addDevice(t, "0000:01:00.0", "vfio-pci", "1")
+	addDevice(t, "0000:01:00.1", "snd_hda_intel", "1")
+	addDevice(t, "0000:02:00.0", "nvme", "2")
+	addDevice(t, "0000:03:00.0", "vfio-pci", "")
+	addDevice(t, "0000:04:00.0", "vfio-pci", "4")
+	addDevice(t, "0000:00:01.0", "pcieport", "4")
+
+	require.ErrorIs(t, Validate("0000:05:00.0"), ErrDeviceNotFound)
+	require.ErrorIs(t, Validate("0000:02:00.0"), ErrNotBound)
+	require.ErrorIs(t, Validate("0000:03:00.0"), ErrNoIOMMU)
+
+	err := Validate("0000:01:00.0")
+	require.ErrorIs(t, err, ErrGroupNotViable)
+	require.ErrorContains(t, err, "0000:01:00.1 (bound to snd_hda_intel)")
+
+	// VFIO device nodes are missing
+	require.ErrorIs(t, Validate("0000:04:00.0"), ErrPermission)
+
+	addDeviceNode(t, "vfio")
+	addDeviceNode(t, "4")
+	require.NoError(t, Validate("0000:04:00.0"))
+}
+
+func TestBind(t *testing.T) {
+	fakeHost(t)
+
+	addDevice(t, "0000:02:00.0", "nvme", "2")
+
+	_, err := Bind("0000:02:00.0")
+	require.ErrorIs(t, err, ErrModuleNotLoaded)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(sysfsPath, "bus", "pci", "drivers", Driver), 0700))
+
+	// The fake sysfs doesn't rebind the device on its own,
+	// so pretend that the kernel did that in advance
+	require.NoError(t, os.WriteFile(filepath.Join(sysfsPath, "bus", "pci", "drivers_probe"), nil, 0600))
+
+	devicePath := filepath.Join(sysfsPath, "bus", "pci", "devices", "0000:02:00.0")
+	require.NoError(t, os.WriteFile(filepath.Join(devicePath, "driver", "unbind"), nil, 0600))
+
+	_, err = Bind("0000:02:00.0")
+	require.ErrorIs(t, err, ErrNotBound)
+
+	driverOverride, err := os.ReadFile(filepath.Join(devicePath, "driver_override"))
+	require.NoError(t, err)
+	require.Equal(t, Driver, string(driverOverride))
+
+	unbind, err := os.ReadFile(filepath.Join(devicePath, "driver", "unbind"))
+	require.NoError(t, err)
+	require.Equal(t, "0000:02:00.0", string(unbind))
+
+	// Binding the device that is already bound to vfio-pci is a no-op
+	addDevice(t, "0000:01:00.0", "vfio-pci", "1")
+
+	previousDriver, err := Bind("0000:01:00.0")
+	require.NoError(t, err)
+	require.Equal(t, Driver, previousDriver)
+}
+
+func fakeHost(t *testing.T) {
+	oldSysfsPath, oldDevfsPath := sysfsPath, devfsPath
+	t.Cleanup(func() {
+		sysfsPath, devfsPath = oldSysfsPath, oldDevfsPath
+	})
+
+	sysfsPath = filepath.Join(t.TempDir(), "sys")
+	devfsPath = filepath.Join(t.TempDir(), "dev")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(sysfsPath, "bus", "pci", "devices"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(devfsPath, "vfio"), 0700))
+}
+
+// addDevice adds a PCI device bound to the specified driver and
+// belonging to the specified IOMMU group, both of which are optional.
+func addDevice(t *testing.T, bdf string, driver string, group string) {
+	devicePath := filepath.Join(sysfsPath, "bus", "pci", "devices", bdf)
+	require.NoError(t, os.MkdirAll(devicePath, 0700))
+
+	if driver != "" {
+		driverPath := filepath.Join(sysfsPath, "bus", "pci", "drivers", driver)
+		require.NoError(t, os.MkdirAll(driverPath, 0700))
+		require.NoError(t, os.Symlink(driverPath, filepath.Join(devicePath, "driver")))
+	}
+
+	if group != "" {
+		groupPath := filepath.Join(sysfsPath, "kernel", "iommu_groups", group)
+		require.NoError(t, os.MkdirAll(filepath.Join(groupPath, "devices"), 0700))
+		require.NoError(t, os.Symlink(groupPath, filepath.Join(devicePath, "iommu_group")))
+		require.NoError(t, os.Symlink(devicePath, filepath.Join(groupPath, "devices", bdf)))
+	}
+}
+
+func addDeviceNode(t *testing.T, name string) {
+	require.NoError(t, os.WriteFile(filepath.Join(devfsPath, "vfio", name), nil, 0600))
+}
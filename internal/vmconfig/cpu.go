@@ -0,0 +1,233 @@
+package vmconfig
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+var ErrInvalidCPUOption = errors.New("invalid CPU option")
+
+// CPU holds the CPU options in addition to the VMConfig's CPUCount,
+// which is the number of vCPUs that the VM boots with.
+type CPU struct {
+	// MaxCount is the maximum number of vCPUs,
+	// the vCPUs above the CPUCount can be hotplugged
+	MaxCount uint16 `json:"maxCount,omitempty"`
+
+	Topology *CPUTopology  `json:"topology,omitempty"`
+	Affinity []CPUAffinity `json:"affinity,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (cpu *CPU) UnmarshalJSON(data []byte) error {
+	type plain CPU
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(cpu))
+	if err != nil {
+		return err
+	}
+
+	cpu.unknownFields = unknownFields
+
+	return nil
+}
+
+func (cpu CPU) MarshalJSON() ([]byte, error) {
+	type plain CPU
+
+	return marshalKnown(plain(cpu), cpu.unknownFields)
+}
+
+// IsEmpty returns true if all the CPU options are reset,
+// in which case they can be omitted from the VM's configuration.
+func (cpu *CPU) IsEmpty() bool {
+	return cpu.MaxCount == 0 && cpu.Topology == nil && len(cpu.Affinity) == 0 && len(cpu.unknownFields) == 0
+}
+
+type CPUTopology struct {
+	ThreadsPerCore uint8 `json:"threadsPerCore"`
+	CoresPerDie    uint8 `json:"coresPerDie"`
+	DiesPerPackage uint8 `json:"diesPerPackage"`
+	Packages       uint8 `json:"packages"`
+
+	unknownFields unknownFields
+}
+
+func (topology *CPUTopology) UnmarshalJSON(data []byte) error {
+	type plain CPUTopology
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(topology))
+	if err != nil {
+		return err
+	}
+
+	topology.unknownFields = unknownFields
+
+	return nil
+}
+
+func (topology CPUTopology) MarshalJSON() ([]byte, error) {
+	type plain CPUTopology
+
+	return marshalKnown(plain(topology), topology.unknownFields)
+}
+
+// CPUAffinity pins the vCPU to the specified host CPUs.
+type CPUAffinity struct {
+	VCPU     uint16   `json:"vcpu"`
+	HostCPUs []uint16 `json:"hostCpus"`
+}
+
+// ParseCPUTopology parses the CPU topology in the
+// THREADS_PER_CORE:CORES_PER_DIE:DIES_PER_PACKAGE:PACKAGES format.
+func ParseCPUTopology(value string) (*CPUTopology, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%w: CPU topology %q should be in the "+
+			"THREADS_PER_CORE:CORES_PER_DIE:DIES_PER_PACKAGE:PACKAGES format", ErrInvalidCPUOption, value)
+	}
+
+	var numbers [4]uint8
+
+	for i, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 8)
+		if err != nil || number == 0 {
+			return nil, fmt.Errorf("%w: CPU topology %q should consist of the positive numbers",
+				ErrInvalidCPUOption, value)
+		}
+
+		numbers[i] = uint8(number)
+	}
+
+	return &CPUTopology{
+		ThreadsPerCore: numbers[0],
+		CoresPerDie:    numbers[1],
+		DiesPerPackage: numbers[2],
+		Packages:       numbers[3],
+	}, nil
+}
+
+// ParseCPUAffinity parses the vCPU affinity in the VCPU:HOST_CPUS format,
+// where HOST_CPUS is a CPU list (e.g. "0:2-3" pins the vCPU 0 to the host CPUs 2 and 3).
+func ParseCPUAffinity(value string) (CPUAffinity, error) {
+	vcpuRaw, hostCPUsRaw, ok := strings.Cut(value, ":")
+	if !ok {
+		return CPUAffinity{}, fmt.Errorf("%w: CPU affinity %q should be in the VCPU:HOST_CPUS format",
+			ErrInvalidCPUOption, value)
+	}
+
+	vcpu, err := strconv.ParseUint(vcpuRaw, 10, 16)
+	if err != nil {
+		return CPUAffinity{}, fmt.Errorf("%w: invalid vCPU in CPU affinity %q: %v",
+			ErrInvalidCPUOption, value, err)
+	}
+
+	hostCPUs, err := ParseCPUList(hostCPUsRaw)
+	if err != nil {
+		return CPUAffinity{}, fmt.Errorf("%w: %v", ErrInvalidCPUOption, err)
+	}
+
+	return CPUAffinity{
+		VCPU:     uint16(vcpu),
+		HostCPUs: hostCPUs,
+	}, nil
+}
+
+func (topology *CPUTopology) String() string {
+	return fmt.Sprintf("%d:%d:%d:%d", topology.ThreadsPerCore, topology.CoresPerDie,
+		topology.DiesPerPackage, topology.Packages)
+}
+
+func (topology *CPUTopology) count() int {
+	return int(topology.ThreadsPerCore) * int(topology.CoresPerDie) *
+		int(topology.DiesPerPackage) * int(topology.Packages)
+}
+
+// maxCPUCount returns the maximum number of vCPUs, taking
+// into account the Cloud Hypervisor's default of a single vCPU.
+func (vmConfig *VMConfig) maxCPUCount() int {
+	result := max(int(vmConfig.CPUCount), 1)
+
+	if vmConfig.CPU != nil {
+		result = max(result, int(vmConfig.CPU.MaxCount))
+	}
+
+	return result
+}
+
+func (vmConfig *VMConfig) validateCPU() error {
+	cpu := vmConfig.CPU
+	if cpu == nil {
+		return nil
+	}
+
+	maxCPUCount := vmConfig.maxCPUCount()
+
+	if cpu.MaxCount != 0 && int(cpu.MaxCount) < max(int(vmConfig.CPUCount), 1) {
+		return fmt.Errorf("%w: maximum number of vCPUs (%d) is less than the number of vCPUs (%d)",
+			ErrInvalidCPUOption, cpu.MaxCount, vmConfig.CPUCount)
+	}
+
+	if cpu.Topology != nil && cpu.Topology.count() != maxCPUCount {
+		return fmt.Errorf("%w: CPU topology %s describes %d vCPUs, but the VM has up to %d vCPUs",
+			ErrInvalidCPUOption, cpu.Topology, cpu.Topology.count(), maxCPUCount)
+	}
+
+	seenVCPUs := map[uint16]struct{}{}
+
+	for _, affinity := range cpu.Affinity {
+		if int(affinity.VCPU) >= maxCPUCount {
+			return fmt.Errorf("%w: CPU affinity references vCPU %d, but the VM has up to %d vCPUs",
+				ErrInvalidCPUOption, affinity.VCPU, maxCPUCount)
+		}
+
+		if _, ok := seenVCPUs[affinity.VCPU]; ok {
+			return fmt.Errorf("%w: CPU affinity for vCPU %d is specified more than once",
+				ErrInvalidCPUOption, affinity.VCPU)
+		}
+		seenVCPUs[affinity.VCPU] = struct{}{}
+
+		if len(affinity.HostCPUs) == 0 {
+			return fmt.Errorf("%w: CPU affinity for vCPU %d has no host CPUs", ErrInvalidCPUOption, affinity.VCPU)
+		}
+	}
+
+	return nil
+}
+
+// cpuOptions renders the Cloud Hypervisor's --cpus parameters.
+func (vmConfig *VMConfig) cpuOptions() []string {
+	var result []string
+
+	if vmConfig.CPUCount != 0 {
+		result = append(result, fmt.Sprintf("boot=%d", vmConfig.CPUCount))
+	}
+
+	cpu := vmConfig.CPU
+	if cpu == nil {
+		return result
+	}
+
+	if cpu.MaxCount != 0 {
+		result = append(result, fmt.Sprintf("max=%d", cpu.MaxCount))
+	}
+
+	if cpu.Topology != nil {
+		result = append(result, fmt.Sprintf("topology=%s", cpu.Topology))
+	}
+
+	if len(cpu.Affinity) != 0 {
+		result = append(result, "affinity="+cloudHypervisorList(lo.Map(cpu.Affinity,
+			func(affinity CPUAffinity, _ int) string {
+				return fmt.Sprintf("%d@%s", affinity.VCPU, cloudHypervisorList(affinity.HostCPUs))
+			},
+		)))
+	}
+
+	return result
+}
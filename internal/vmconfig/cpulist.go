@@ -0,0 +1,81 @@
+package vmconfig
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// ParseCPUList parses the CPU list in the Linux kernel's
+// cpulist format (e.g. "0-3,8"), see cpuset(7) for details.
+func ParseCPUList(value string) ([]uint16, error) {
+	var result []uint16
+
+	for _, part := range strings.Split(value, ",") {
+		firstRaw, lastRaw, isRange := strings.Cut(part, "-")
+
+		first, err := strconv.ParseUint(firstRaw, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q: %v", value, err)
+		}
+
+		last := first
+
+		if isRange {
+			last, err = strconv.ParseUint(lastRaw, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CPU list %q: %v", value, err)
+			}
+
+			if last < first {
+				return nil, fmt.Errorf("invalid CPU list %q: range %s is reversed", value, part)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			result = append(result, uint16(cpu))
+		}
+	}
+
+	slices.Sort(result)
+
+	return slices.Compact(result), nil
+}
+
+// FormatCPUList formats the CPU list in the Linux kernel's cpulist
+// format (e.g. "0-3,8"), which is the inverse of ParseCPUList.
+func FormatCPUList(cpus []uint16) string {
+	sorted := slices.Clone(cpus)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	var parts []string
+
+	for i := 0; i < len(sorted); {
+		j := i
+
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+
+		if i == j {
+			parts = append(parts, fmt.Sprintf("%d", sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// cloudHypervisorList formats the list in the Cloud Hypervisor's list syntax (e.g. "[0,1,2]")
+func cloudHypervisorList[T any](values []T) string {
+	return "[" + strings.Join(lo.Map(values, func(value T, _ int) string {
+		return fmt.Sprintf("%v", value)
+	}), ",") + "]"
+}
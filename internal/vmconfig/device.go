@@ -0,0 +1,138 @@
+package vmconfig
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cirruslabs/vetu/internal/vfio"
+)
+
+var ErrInvalidDevice = errors.New("invalid device")
+
+// Device is a host device directly assigned to the VM using VFIO.
+type Device struct {
+	// Path is the device's sysfs directory
+	// (e.g. /sys/bus/pci/devices/0000:01:00.0/)
+	Path string `json:"path"`
+
+	IOMMU      bool   `json:"iommu,omitempty"`
+	PCISegment uint16 `json:"pciSegment,omitempty"`
+	ID         string `json:"id,omitempty"`
+
+	// Options are the other Cloud Hypervisor's "--device" parameters
+	// (e.g. x_nv_gpudirect_clique=0) in the KEY=VALUE format, which
+	// are passed to the Cloud Hypervisor as is
+	Options []string `json:"options,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (device *Device) UnmarshalJSON(data []byte) error {
+	type plain Device
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(device))
+	if err != nil {
+		return err
+	}
+
+	device.unknownFields = unknownFields
+
+	return nil
+}
+
+func (device Device) MarshalJSON() ([]byte, error) {
+	type plain Device
+
+	return marshalKnown(plain(device), device.unknownFields)
+}
+
+// ParseDevice parses the device either specified by its PCI address
+// (e.g. 0000:01:00.0), or in the Cloud Hypervisor's "--device" format
+// (e.g. path=/sys/bus/pci/devices/0000:01:00.0/,iommu=on).
+func ParseDevice(value string) (Device, error) {
+	if bdf, err := vfio.ParseBDF(value); err == nil {
+		return Device{Path: vfio.DevicePath(bdf)}, nil
+	}
+
+	var device Device
+
+	for _, option := range strings.Split(value, ",") {
+		key, optionValue, ok := strings.Cut(option, "=")
+		if !ok {
+			return Device{}, fmt.Errorf("%w: device option %q should be in the KEY=VALUE format, "+
+				"or the device should be specified by its PCI address (e.g. 0000:01:00.0)",
+				ErrInvalidDevice, option)
+		}
+
+		switch key {
+		case "path":
+			device.Path = optionValue
+		case "iommu":
+			// Cloud Hypervisor accepts both the on/off and the true/false values
+			switch optionValue {
+			case "on", "true":
+				device.IOMMU = true
+			case "off", "false":
+				device.IOMMU = false
+			default:
+				return Device{}, fmt.Errorf("%w: device option \"iommu\" should be either \"on\" or \"off\"",
+					ErrInvalidDevice)
+			}
+		case "pci_segment":
+			pciSegment, err := strconv.ParseUint(optionValue, 10, 16)
+			if err != nil {
+				return Device{}, fmt.Errorf("%w: failed to parse device option \"pci_segment\": %v",
+					ErrInvalidDevice, err)
+			}
+
+			device.PCISegment = uint16(pciSegment)
+		case "id":
+			device.ID = optionValue
+		default:
+			device.Options = append(device.Options, option)
+		}
+	}
+
+	if err := device.Validate(); err != nil {
+		return Device{}, err
+	}
+
+	return device, nil
+}
+
+func (device Device) Validate() error {
+	if device.Path == "" {
+		return fmt.Errorf("%w: device path cannot be empty", ErrInvalidDevice)
+	}
+
+	return nil
+}
+
+// BDF returns the PCI address of the device, or false if
+// the device is not a PCI device (e.g. a mediated device).
+func (device Device) BDF() (string, bool) {
+	return vfio.BDFFromPath(device.Path)
+}
+
+// String renders the device in the Cloud Hypervisor's "--device" format.
+func (device Device) String() string {
+	options := []string{"path=" + device.Path}
+
+	if device.IOMMU {
+		options = append(options, "iommu=on")
+	}
+
+	if device.PCISegment != 0 {
+		options = append(options, fmt.Sprintf("pci_segment=%d", device.PCISegment))
+	}
+
+	if device.ID != "" {
+		options = append(options, "id="+device.ID)
+	}
+
+	options = append(options, device.Options...)
+
+	return strings.Join(options, ",")
+}
@@ -0,0 +1,325 @@
+package vmconfig
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDiskOption = errors.New("invalid disk option")
+
+type ImageType string
+
+const (
+	ImageTypeRaw   ImageType = "raw"
+	ImageTypeQCOW2 ImageType = "qcow2"
+)
+
+// maxSerialLength is the maximum length of the virtio-blk device's serial number
+const maxSerialLength = 20
+
+type Disk struct {
+	Name      string     `json:"name"`
+	ReadOnly  bool       `json:"readOnly,omitempty"`
+	Direct    bool       `json:"direct,omitempty"`
+	Sparse    *bool      `json:"sparse,omitempty"`
+	NumQueues uint16     `json:"numQueues,omitempty"`
+	QueueSize uint16     `json:"queueSize,omitempty"`
+	Serial    string     `json:"serial,omitempty"`
+	ImageType ImageType  `json:"imageType,omitempty"`
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (disk *Disk) UnmarshalJSON(data []byte) error {
+	type plain Disk
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(disk))
+	if err != nil {
+		return err
+	}
+
+	disk.unknownFields = unknownFields
+
+	return nil
+}
+
+func (disk Disk) MarshalJSON() ([]byte, error) {
+	type plain Disk
+
+	return marshalKnown(plain(disk), disk.unknownFields)
+}
+
+// RateLimit limits the disk's bandwidth (in bytes) and/or
+// the disk's operations using token buckets.
+type RateLimit struct {
+	Bandwidth  *TokenBucket `json:"bandwidth,omitempty"`
+	Operations *TokenBucket `json:"operations,omitempty"`
+}
+
+type TokenBucket struct {
+	// Size is the number of tokens in the bucket
+	Size uint64 `json:"size"`
+
+	// OneTimeBurst is the number of additional tokens
+	// that are only available once, initially
+	OneTimeBurst uint64 `json:"oneTimeBurst,omitempty"`
+
+	// RefillTime is the time it takes to refill
+	// the bucket completely, in milliseconds
+	RefillTime uint64 `json:"refillTime"`
+}
+
+// DiskOptions lists the options accepted by SetOption,
+// which are named after the Cloud Hypervisor's --disk parameters.
+var DiskOptions = []string{
+	"readonly", "direct", "sparse", "num_queues", "queue_size", "serial", "image_type",
+	"bw_size", "bw_one_time_burst", "bw_refill_time",
+	"ops_size", "ops_one_time_burst", "ops_refill_time",
+}
+
+// SetOption sets the disk's option, an empty value resets the option to its default.
+func (disk *Disk) SetOption(key string, value string) error {
+	var err error
+
+	switch key {
+	case "readonly":
+		disk.ReadOnly, err = parseBool(value)
+	case "direct":
+		disk.Direct, err = parseBool(value)
+	case "sparse":
+		disk.Sparse, err = parseOptionalBool(value)
+	case "num_queues":
+		disk.NumQueues, err = parseUint16(value)
+	case "queue_size":
+		disk.QueueSize, err = parseUint16(value)
+	case "serial":
+		disk.Serial = value
+	case "image_type":
+		disk.ImageType = ImageType(value)
+	case "bw_size", "bw_one_time_burst", "bw_refill_time",
+		"ops_size", "ops_one_time_burst", "ops_refill_time":
+		err = disk.setRateLimit(key, value)
+	default:
+		return fmt.Errorf("%w: unknown option %q, supported options are: %s",
+			ErrInvalidDiskOption, key, strings.Join(DiskOptions, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s=%s: %v", ErrInvalidDiskOption, key, value, err)
+	}
+
+	return nil
+}
+
+// Validate ensures that the disk's options can be passed to Cloud Hypervisor.
+func (disk *Disk) Validate() error {
+	switch disk.ImageType {
+	case "", ImageTypeRaw, ImageTypeQCOW2:
+		// supported
+	default:
+		return fmt.Errorf("%w: unsupported image type %q, supported types are: %s, %s",
+			ErrInvalidDiskOption, disk.ImageType, ImageTypeRaw, ImageTypeQCOW2)
+	}
+
+	if len(disk.Serial) > maxSerialLength {
+		return fmt.Errorf("%w: serial %q is longer than %d characters",
+			ErrInvalidDiskOption, disk.Serial, maxSerialLength)
+	}
+
+	// Cloud Hypervisor's --disk parameters are separated with commas
+	// and don't support quoting, so these would break the rendering
+	if strings.ContainsAny(disk.Serial, ",=") {
+		return fmt.Errorf("%w: serial %q cannot contain \",\" or \"=\"", ErrInvalidDiskOption, disk.Serial)
+	}
+
+	if disk.QueueSize != 0 && disk.QueueSize&(disk.QueueSize-1) != 0 {
+		return fmt.Errorf("%w: queue size %d is not a power of two", ErrInvalidDiskOption, disk.QueueSize)
+	}
+
+	if disk.RateLimit != nil {
+		for _, tokenBucket := range []lo.Tuple2[string, *TokenBucket]{
+			lo.T2("bandwidth", disk.RateLimit.Bandwidth),
+			lo.T2("operations", disk.RateLimit.Operations),
+		} {
+			if tokenBucket.B == nil {
+				continue
+			}
+
+			if tokenBucket.B.Size == 0 || tokenBucket.B.RefillTime == 0 {
+				return fmt.Errorf("%w: %s rate limit requires both the size and the refill time",
+					ErrInvalidDiskOption, tokenBucket.A)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CloudHypervisorArgument renders the disk as the Cloud Hypervisor's
+// --disk argument, with the disk located in the specified VM directory.
+func (disk *Disk) CloudHypervisorArgument(vmDirPath string) string {
+	options := append([]string{fmt.Sprintf("path=%s", filepath.Join(vmDirPath, disk.Name))},
+		disk.CloudHypervisorOptions()...)
+
+	return strings.Join(options, ",")
+}
+
+// CloudHypervisorOptions renders the disk's options
+// (except for the path) as the Cloud Hypervisor's --disk parameters.
+func (disk *Disk) CloudHypervisorOptions() []string {
+	var result []string
+
+	if disk.ReadOnly {
+		result = append(result, "readonly=on")
+	}
+	if disk.Direct {
+		result = append(result, "direct=on")
+	}
+	// Cloud Hypervisor treats the disks as sparse by default, punching
+	// holes in the disk file on guest's discard (TRIM) requests, so only
+	// the opt-out needs to be rendered
+	if disk.Sparse != nil && !*disk.Sparse {
+		result = append(result, "sparse=off")
+	}
+	if disk.NumQueues != 0 {
+		result = append(result, fmt.Sprintf("num_queues=%d", disk.NumQueues))
+	}
+	if disk.QueueSize != 0 {
+		result = append(result, fmt.Sprintf("queue_size=%d", disk.QueueSize))
+	}
+	if disk.Serial != "" {
+		result = append(result, fmt.Sprintf("serial=%s", disk.Serial))
+	}
+	if disk.ImageType != "" {
+		result = append(result, fmt.Sprintf("image_type=%s", disk.ImageType))
+	}
+
+	if disk.RateLimit != nil {
+		result = append(result, disk.RateLimit.Bandwidth.cloudHypervisorOptions("bw")...)
+		result = append(result, disk.RateLimit.Operations.cloudHypervisorOptions("ops")...)
+	}
+
+	return result
+}
+
+func (tokenBucket *TokenBucket) cloudHypervisorOptions(prefix string) []string {
+	if tokenBucket == nil {
+		return nil
+	}
+
+	result := []string{
+		fmt.Sprintf("%s_size=%d", prefix, tokenBucket.Size),
+		fmt.Sprintf("%s_refill_time=%d", prefix, tokenBucket.RefillTime),
+	}
+
+	if tokenBucket.OneTimeBurst != 0 {
+		result = append(result, fmt.Sprintf("%s_one_time_burst=%d", prefix, tokenBucket.OneTimeBurst))
+	}
+
+	return result
+}
+
+// setRateLimit sets the field of one of the disk's token buckets,
+// creating the bucket on demand and removing the buckets that become empty.
+func (disk *Disk) setRateLimit(key string, value string) error {
+	prefix, field, _ := strings.Cut(key, "_")
+
+	// Bandwidth token bucket size is expressed in bytes
+	parse := parseUint64
+	if prefix == "bw" && field != "refill_time" {
+		parse = parseBytes
+	}
+
+	parsedValue, err := parse(value)
+	if err != nil {
+		return err
+	}
+
+	if disk.RateLimit == nil {
+		disk.RateLimit = &RateLimit{}
+	}
+
+	tokenBucket := &disk.RateLimit.Operations
+	if prefix == "bw" {
+		tokenBucket = &disk.RateLimit.Bandwidth
+	}
+
+	if *tokenBucket == nil {
+		*tokenBucket = &TokenBucket{}
+	}
+
+	switch field {
+	case "size":
+		(*tokenBucket).Size = parsedValue
+	case "one_time_burst":
+		(*tokenBucket).OneTimeBurst = parsedValue
+	case "refill_time":
+		(*tokenBucket).RefillTime = parsedValue
+	}
+
+	if **tokenBucket == (TokenBucket{}) {
+		*tokenBucket = nil
+	}
+
+	if *disk.RateLimit == (RateLimit{}) {
+		disk.RateLimit = nil
+	}
+
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch value {
+	case "", "off", "false":
+		return false, nil
+	case "on", "true":
+		return true, nil
+	default:
+		return false, fmt.Errorf("expected \"on\" or \"off\"")
+	}
+}
+
+// parseOptionalBool is like parseBool, but returns nil for an empty value.
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	result, err := parseBool(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func parseUint16(value string) (uint16, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	result, err := strconv.ParseUint(value, 10, 16)
+
+	return uint16(result), err
+}
+
+func parseUint64(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func parseBytes(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return humanize.ParseBytes(value)
+}
@@ -0,0 +1,389 @@
+package vmconfig
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+)
+
+var ErrInvalidMemoryOption = errors.New("invalid memory option")
+
+// Memory holds the memory options in addition to the
+// VMConfig's MemorySize, which is the VM's memory size.
+type Memory struct {
+	// Shared maps the memory as MAP_SHARED, which is
+	// needed for the vhost-user devices (e.g. virtio-fs)
+	Shared bool `json:"shared,omitempty"`
+
+	// Hugepages backs the memory with the huge pages, which need to be
+	// reserved on the host beforehand (e.g. via /proc/sys/vm/nr_hugepages)
+	Hugepages bool `json:"hugepages,omitempty"`
+
+	// HugepageSize is the size of the huge pages in bytes,
+	// the host's default huge page size is used if not set
+	HugepageSize uint64 `json:"hugepageSize,omitempty"`
+
+	// HotplugSize is the amount of memory in bytes that can be
+	// hotplugged into the running VM in addition to its MemorySize
+	HotplugSize uint64 `json:"hotplugSize,omitempty"`
+
+	// HotplugMethod is the memory hotplug mechanism, ACPI
+	// is used if not set, which only allows adding memory
+	HotplugMethod HotplugMethod `json:"hotplugMethod,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (memory *Memory) UnmarshalJSON(data []byte) error {
+	type plain Memory
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(memory))
+	if err != nil {
+		return err
+	}
+
+	memory.unknownFields = unknownFields
+
+	return nil
+}
+
+func (memory Memory) MarshalJSON() ([]byte, error) {
+	type plain Memory
+
+	return marshalKnown(plain(memory), memory.unknownFields)
+}
+
+// IsEmpty returns true if all the memory options are reset,
+// in which case they can be omitted from the VM's configuration.
+func (memory *Memory) IsEmpty() bool {
+	return !memory.Shared && !memory.Hugepages && memory.HugepageSize == 0 &&
+		memory.HotplugSize == 0 && memory.HotplugMethod == "" && len(memory.unknownFields) == 0
+}
+
+type HotplugMethod string
+
+const (
+	HotplugMethodACPI      HotplugMethod = "acpi"
+	HotplugMethodVirtioMem HotplugMethod = "virtio-mem"
+)
+
+// Balloon is a virtio-balloon device, which allows to reclaim
+// the guest's memory at run-time (see "vetu balloon").
+type Balloon struct {
+	// Size is the initial size of the balloon in bytes,
+	// which is the amount of memory reclaimed from the guest
+	Size uint64 `json:"size,omitempty"`
+
+	// DeflateOnOOM deflates the balloon when the guest runs out of memory
+	DeflateOnOOM bool `json:"deflateOnOOM,omitempty"`
+
+	// FreePageReporting makes the guest report the free pages,
+	// which are then returned to the host
+	FreePageReporting bool `json:"freePageReporting,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (balloon *Balloon) UnmarshalJSON(data []byte) error {
+	type plain Balloon
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(balloon))
+	if err != nil {
+		return err
+	}
+
+	balloon.unknownFields = unknownFields
+
+	return nil
+}
+
+func (balloon Balloon) MarshalJSON() ([]byte, error) {
+	type plain Balloon
+
+	return marshalKnown(plain(balloon), balloon.unknownFields)
+}
+
+// NUMANode is a guest NUMA node that consists of the specified
+// vCPUs and memory, the VM's MemorySize is split between the nodes.
+type NUMANode struct {
+	ID         uint32         `json:"id"`
+	CPUs       []uint16       `json:"cpus,omitempty"`
+	MemorySize uint64         `json:"memorySize"`
+	Distances  []NUMADistance `json:"distances,omitempty"`
+
+	unknownFields unknownFields
+}
+
+func (numaNode *NUMANode) UnmarshalJSON(data []byte) error {
+	type plain NUMANode
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(numaNode))
+	if err != nil {
+		return err
+	}
+
+	numaNode.unknownFields = unknownFields
+
+	return nil
+}
+
+func (numaNode NUMANode) MarshalJSON() ([]byte, error) {
+	type plain NUMANode
+
+	return marshalKnown(plain(numaNode), numaNode.unknownFields)
+}
+
+// NUMADistance is the relative distance (the SLIT value) to the destination NUMA node.
+type NUMADistance struct {
+	Destination uint32 `json:"destination"`
+	Distance    uint8  `json:"distance"`
+}
+
+// ParseNUMANode parses the NUMA node in the ID:CPUS:MEMORY_SIZE[:DISTANCES] format,
+// where CPUS is a CPU list and DISTANCES is a comma-separated list of DESTINATION@DISTANCE
+// (e.g. "0:0-3:4GiB:1@20" is a node with the vCPUs 0 to 3 and 4 GiB of memory).
+func ParseNUMANode(value string) (NUMANode, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return NUMANode{}, fmt.Errorf("%w: NUMA node %q should be in the ID:CPUS:MEMORY_SIZE[:DISTANCES] format",
+			ErrInvalidMemoryOption, value)
+	}
+
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return NUMANode{}, fmt.Errorf("%w: invalid NUMA node ID in %q: %v", ErrInvalidMemoryOption, value, err)
+	}
+
+	numaNode := NUMANode{
+		ID: uint32(id),
+	}
+
+	if parts[1] != "" {
+		numaNode.CPUs, err = ParseCPUList(parts[1])
+		if err != nil {
+			return NUMANode{}, fmt.Errorf("%w: %v", ErrInvalidMemoryOption, err)
+		}
+	}
+
+	numaNode.MemorySize, err = humanize.ParseBytes(parts[2])
+	if err != nil {
+		return NUMANode{}, fmt.Errorf("%w: invalid memory size in NUMA node %q: %v",
+			ErrInvalidMemoryOption, value, err)
+	}
+
+	if len(parts) == 4 {
+		for _, distanceRaw := range strings.Split(parts[3], ",") {
+			destinationRaw, valueRaw, _ := strings.Cut(distanceRaw, "@")
+
+			destination, err := strconv.ParseUint(destinationRaw, 10, 32)
+			if err != nil {
+				return NUMANode{}, fmt.Errorf("%w: invalid distance %q in NUMA node %q",
+					ErrInvalidMemoryOption, distanceRaw, value)
+			}
+
+			distance, err := strconv.ParseUint(valueRaw, 10, 8)
+			if err != nil {
+				return NUMANode{}, fmt.Errorf("%w: invalid distance %q in NUMA node %q",
+					ErrInvalidMemoryOption, distanceRaw, value)
+			}
+
+			numaNode.Distances = append(numaNode.Distances, NUMADistance{
+				Destination: uint32(destination),
+				Distance:    uint8(distance),
+			})
+		}
+	}
+
+	return numaNode, nil
+}
+
+func (vmConfig *VMConfig) validateMemory() error {
+	if memory := vmConfig.Memory; memory != nil && memory.HugepageSize != 0 {
+		if !memory.Hugepages {
+			return fmt.Errorf("%w: huge page size requires huge pages to be enabled", ErrInvalidMemoryOption)
+		}
+
+		if memory.HugepageSize&(memory.HugepageSize-1) != 0 {
+			return fmt.Errorf("%w: huge page size %d is not a power of two",
+				ErrInvalidMemoryOption, memory.HugepageSize)
+		}
+	}
+
+	if memory := vmConfig.Memory; memory != nil {
+		switch memory.HotplugMethod {
+		case "", HotplugMethodACPI, HotplugMethodVirtioMem:
+			// supported
+		default:
+			return fmt.Errorf("%w: unsupported memory hotplug method %q, supported methods are: %s, %s",
+				ErrInvalidMemoryOption, memory.HotplugMethod, HotplugMethodACPI, HotplugMethodVirtioMem)
+		}
+
+		if memory.HotplugSize != 0 && len(vmConfig.NUMANodes) != 0 {
+			return fmt.Errorf("%w: memory hotplug is not supported for the VMs with NUMA nodes",
+				ErrInvalidMemoryOption)
+		}
+	}
+
+	if balloon := vmConfig.Balloon; balloon != nil && vmConfig.MemorySize != 0 && balloon.Size > vmConfig.MemorySize {
+		return fmt.Errorf("%w: balloon size of %s exceeds the VM's memory size of %s", ErrInvalidMemoryOption,
+			humanize.IBytes(balloon.Size), humanize.IBytes(vmConfig.MemorySize))
+	}
+
+	if len(vmConfig.NUMANodes) == 0 {
+		return nil
+	}
+
+	maxCPUCount := vmConfig.maxCPUCount()
+	numaNodeIDs := map[uint32]struct{}{}
+	numaNodeCPUs := map[uint16]uint32{}
+
+	var totalMemorySize uint64
+
+	for _, numaNode := range vmConfig.NUMANodes {
+		if _, ok := numaNodeIDs[numaNode.ID]; ok {
+			return fmt.Errorf("%w: NUMA node %d is specified more than once", ErrInvalidMemoryOption, numaNode.ID)
+		}
+		numaNodeIDs[numaNode.ID] = struct{}{}
+
+		if numaNode.MemorySize == 0 {
+			return fmt.Errorf("%w: NUMA node %d has no memory", ErrInvalidMemoryOption, numaNode.ID)
+		}
+		totalMemorySize += numaNode.MemorySize
+
+		for _, cpu := range numaNode.CPUs {
+			if int(cpu) >= maxCPUCount {
+				return fmt.Errorf("%w: NUMA node %d references vCPU %d, but the VM has up to %d vCPUs",
+					ErrInvalidMemoryOption, numaNode.ID, cpu, maxCPUCount)
+			}
+
+			if otherID, ok := numaNodeCPUs[cpu]; ok {
+				return fmt.Errorf("%w: vCPU %d belongs to both NUMA nodes %d and %d",
+					ErrInvalidMemoryOption, cpu, otherID, numaNode.ID)
+			}
+			numaNodeCPUs[cpu] = numaNode.ID
+		}
+	}
+
+	for _, numaNode := range vmConfig.NUMANodes {
+		for _, distance := range numaNode.Distances {
+			if _, ok := numaNodeIDs[distance.Destination]; !ok || distance.Destination == numaNode.ID {
+				return fmt.Errorf("%w: NUMA node %d has a distance to an invalid NUMA node %d",
+					ErrInvalidMemoryOption, numaNode.ID, distance.Destination)
+			}
+		}
+	}
+
+	if vmConfig.MemorySize != 0 && vmConfig.MemorySize != totalMemorySize {
+		return fmt.Errorf("%w: NUMA nodes have %s of memory in total, but the VM's memory size is %s",
+			ErrInvalidMemoryOption, humanize.IBytes(totalMemorySize), humanize.IBytes(vmConfig.MemorySize))
+	}
+
+	return nil
+}
+
+// balloonArguments renders the Cloud Hypervisor's --balloon argument.
+func (vmConfig *VMConfig) balloonArguments() []string {
+	balloon := vmConfig.Balloon
+	if balloon == nil {
+		return nil
+	}
+
+	balloonOptions := []string{fmt.Sprintf("size=%d", balloon.Size)}
+
+	if balloon.DeflateOnOOM {
+		balloonOptions = append(balloonOptions, "deflate_on_oom=on")
+	}
+	if balloon.FreePageReporting {
+		balloonOptions = append(balloonOptions, "free_page_reporting=on")
+	}
+
+	return []string{"--balloon", strings.Join(balloonOptions, ",")}
+}
+
+// memoryArguments renders the Cloud Hypervisor's --memory, --memory-zone and --numa
+// arguments. With NUMA nodes, the memory is split into per-node memory zones.
+func (vmConfig *VMConfig) memoryArguments() []string {
+	var backingOptions []string
+
+	if memory := vmConfig.Memory; memory != nil {
+		if memory.Shared {
+			backingOptions = append(backingOptions, "shared=on")
+		}
+		if memory.Hugepages {
+			backingOptions = append(backingOptions, "hugepages=on")
+		}
+		if memory.HugepageSize != 0 {
+			backingOptions = append(backingOptions, fmt.Sprintf("hugepage_size=%d", memory.HugepageSize))
+		}
+	}
+
+	var hotplugOptions []string
+
+	if memory := vmConfig.Memory; memory != nil && memory.HotplugSize != 0 {
+		hotplugOptions = append(hotplugOptions, fmt.Sprintf("hotplug_size=%d", memory.HotplugSize))
+
+		if memory.HotplugMethod != "" {
+			hotplugOptions = append(hotplugOptions, fmt.Sprintf("hotplug_method=%s", memory.HotplugMethod))
+		}
+	}
+
+	if len(vmConfig.NUMANodes) == 0 {
+		var memoryOptions []string
+
+		if vmConfig.MemorySize != 0 {
+			memoryOptions = append(memoryOptions, fmt.Sprintf("size=%d", vmConfig.MemorySize))
+		}
+
+		memoryOptions = append(memoryOptions, backingOptions...)
+		memoryOptions = append(memoryOptions, hotplugOptions...)
+
+		if len(memoryOptions) == 0 {
+			return nil
+		}
+
+		return []string{"--memory", strings.Join(memoryOptions, ",")}
+	}
+
+	result := []string{"--memory", "size=0", "--memory-zone"}
+
+	for _, numaNode := range vmConfig.NUMANodes {
+		zoneOptions := append([]string{
+			fmt.Sprintf("id=%s", numaNode.memoryZoneID()),
+			fmt.Sprintf("size=%d", numaNode.MemorySize),
+		}, backingOptions...)
+
+		result = append(result, strings.Join(zoneOptions, ","))
+	}
+
+	result = append(result, "--numa")
+
+	for _, numaNode := range vmConfig.NUMANodes {
+		numaOptions := []string{fmt.Sprintf("guest_numa_id=%d", numaNode.ID)}
+
+		if len(numaNode.CPUs) != 0 {
+			numaOptions = append(numaOptions, "cpus="+cloudHypervisorList(numaNode.CPUs))
+		}
+
+		if len(numaNode.Distances) != 0 {
+			numaOptions = append(numaOptions, "distances="+cloudHypervisorList(lo.Map(numaNode.Distances,
+				func(distance NUMADistance, _ int) string {
+					return fmt.Sprintf("%d@%d", distance.Destination, distance.Distance)
+				},
+			)))
+		}
+
+		numaOptions = append(numaOptions, "memory_zones="+numaNode.memoryZoneID())
+
+		result = append(result, strings.Join(numaOptions, ","))
+	}
+
+	return result
+}
+
+func (numaNode *NUMANode) memoryZoneID() string {
+	return fmt.Sprintf("mem%d", numaNode.ID)
+}
@@ -0,0 +1,84 @@
+package vmconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cirruslabs/vetu/internal/version"
+)
+
+var ErrNewerVersion = errors.New("VM configuration requires a newer vetu version")
+
+// migration upgrades the VM configuration (represented as
+// a generic JSON object) from its version to the next version.
+type migration func(vmConfig map[string]any) error
+
+// migrations[i] upgrades the VM configuration from version i+1 to version i+2,
+// so that CurrentVersion always equals len(migrations) + 1.
+//
+// Bump the CurrentVersion and add a migration when the configuration changes
+// in a way that older vetu versions cannot ignore (e.g. a field is renamed
+// or its meaning changes), and update the VMConfig's requiredVersion().
+// Fields that can be safely ignored by older vetu versions can be added
+// without bumping the version.
+var migrations = []migration{
+	// Version 2 adds the fields that older vetu versions cannot ignore without
+	// running the VM incorrectly: the disk's "readOnly" option, the memory's
+	// "hugepages" option, the "numaNodes", the passed through "devices" and
+	// more than 255 vCPUs, the version 1 configuration has none of them,
+	// so nothing needs to change
+	migrateNoop,
+}
+
+func migrateNoop(_ map[string]any) error {
+	return nil
+}
+
+// checkVersion ensures that the VM configuration
+// of the specified version can be migrated.
+func checkVersion(vmConfigVersion int, currentVersion int) error {
+	if vmConfigVersion > currentVersion {
+		return fmt.Errorf("%w: got version %d, but vetu %s only supports versions up to %d, "+
+			"please upgrade vetu", ErrNewerVersion, vmConfigVersion, version.Version, currentVersion)
+	}
+
+	if vmConfigVersion < 1 {
+		return fmt.Errorf("%w: unsupported VM configuration version %d", ErrFailedToParse, vmConfigVersion)
+	}
+
+	return nil
+}
+
+// migrate upgrades the VM configuration of the specified version
+// to the latest version by applying the relevant migrations.
+func migrate(vmConfigBytes []byte, vmConfigVersion int, migrations []migration) ([]byte, error) {
+	if err := checkVersion(vmConfigVersion, len(migrations)+1); err != nil {
+		return nil, err
+	}
+
+	if vmConfigVersion == len(migrations)+1 {
+		return vmConfigBytes, nil
+	}
+
+	var vmConfig map[string]any
+
+	decoder := json.NewDecoder(bytes.NewReader(vmConfigBytes))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&vmConfig); err != nil {
+		return nil, err
+	}
+
+	for i := vmConfigVersion - 1; i < len(migrations); i++ {
+		if err := migrations[i](vmConfig); err != nil {
+			return nil, fmt.Errorf("%w: failed to migrate from version %d to version %d: %v",
+				ErrFailedToParse, i+1, i+2, err)
+		}
+
+		vmConfig["version"] = i + 2
+	}
+
+	return json.Marshal(vmConfig)
+}
@@ -0,0 +1,129 @@
+package vmconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsMatchCurrentVersion(t *testing.T) {
+	require.Equal(t, CurrentVersion, len(migrations)+1)
+}
+
+func TestMigrate(t *testing.T) {
+	testMigrations := []migration{
+		// Version 2 renames "cmdline" to "kernelCmdline"
+		func(vmConfig map[string]any) error {
+			if cmdline, ok := vmConfig["cmdline"]; ok {
+				vmConfig["kernelCmdline"] = cmdline
+				delete(vmConfig, "cmdline")
+			}
+
+			return nil
+		},
+		// Version 3 moves "cpuCount" into the "cpu" object
+		func(vmConfig map[string]any) error {
+			if cpuCount, ok := vmConfig["cpuCount"]; ok {
+				vmConfig["cpu"] = map[string]any{"count": cpuCount}
+				delete(vmConfig, "cpuCount")
+			}
+
+			return nil
+		},
+	}
+
+	for _, testCase := range []struct {
+		Name    string
+		Version int
+	}{
+		{Name: "v1.json", Version: 1},
+		{Name: "v2.json", Version: 2},
+		{Name: "v3.json", Version: 3},
+	} {
+		t.Run(testCase.Name, func(t *testing.T) {
+			vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "migrate", testCase.Name))
+			require.NoError(t, err)
+
+			expectedBytes, err := os.ReadFile(filepath.Join("testdata", "migrate", "v3.golden.json"))
+			require.NoError(t, err)
+
+			actualBytes, err := migrate(vmConfigBytes, testCase.Version, testMigrations)
+			require.NoError(t, err)
+			require.JSONEq(t, string(expectedBytes), string(actualBytes))
+		})
+	}
+}
+
+func TestMigrateVersion1(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "version1.json"))
+	require.NoError(t, err)
+
+	expectedBytes, err := os.ReadFile(filepath.Join("testdata", "version1.golden.json"))
+	require.NoError(t, err)
+
+	vmConfig, err := NewFromJSON(vmConfigBytes)
+	require.NoError(t, err)
+
+	// VM configuration that doesn't use any of the version 2
+	// fields should still be saved as version 1
+	actualBytes, err := json.Marshal(vmConfig)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expectedBytes), string(actualBytes))
+}
+
+func TestRequiredVersion(t *testing.T) {
+	for name, modify := range map[string]func(vmConfig *VMConfig){
+		"read-only disk": func(vmConfig *VMConfig) {
+			vmConfig.Disks = []Disk{{Name: "disk.img", ReadOnly: true}}
+		},
+		"hugepages": func(vmConfig *VMConfig) {
+			vmConfig.Memory = &Memory{Hugepages: true}
+		},
+		"NUMA nodes": func(vmConfig *VMConfig) {
+			vmConfig.NUMANodes = []NUMANode{{MemorySize: 1024 * 1024 * 1024}}
+		},
+		"devices": func(vmConfig *VMConfig) {
+			vmConfig.Devices = []Device{{Path: "/sys/bus/pci/devices/0000:01:00.0/"}}
+		},
+		"more than 255 vCPUs": func(vmConfig *VMConfig) {
+			vmConfig.CPUCount = 256
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			vmConfig := New()
+			require.Equal(t, 1, vmConfig.requiredVersion())
+
+			modify(vmConfig)
+			require.Equal(t, 2, vmConfig.requiredVersion())
+
+			vmConfigBytes, err := json.Marshal(vmConfig)
+			require.NoError(t, err)
+
+			var versioned struct {
+				Version int `json:"version"`
+			}
+
+			require.NoError(t, json.Unmarshal(vmConfigBytes, &versioned))
+			require.Equal(t, 2, versioned.Version)
+		})
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	testMigrations := []migration{
+		func(vmConfig map[string]any) error {
+			return errors.New("cannot migrate")
+		},
+	}
+
+	_, err := migrate([]byte(`{"version":1}`), 1, testMigrations)
+	require.ErrorIs(t, err, ErrFailedToParse)
+	require.Contains(t, err.Error(), "failed to migrate from version 1 to version 2: cannot migrate")
+
+	_, err = migrate([]byte(`{"version":3}`), 3, testMigrations)
+	require.ErrorIs(t, err, ErrNewerVersion)
+}
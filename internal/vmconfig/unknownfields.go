@@ -0,0 +1,109 @@
+package vmconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// unknownFields holds the JSON object fields that this version of vetu doesn't
+// know about (e.g. added by a newer vetu), so that they survive the round-trip
+// through the VM directory's SetConfig() instead of being silently dropped.
+type unknownFields map[string]json.RawMessage
+
+// unmarshalKnown unmarshals the JSON object into the known struct
+// and returns the fields that the struct doesn't have.
+func unmarshalKnown(data []byte, known any) (unknownFields, error) {
+	if err := json.Unmarshal(data, known); err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	knownNames := jsonFieldNames(reflect.TypeOf(known).Elem())
+
+	result := unknownFields{}
+
+	for name, value := range fields {
+		// encoding/json matches the field names case-insensitively
+		isKnown := slices.ContainsFunc(knownNames, func(knownName string) bool {
+			return strings.EqualFold(knownName, name)
+		})
+
+		if !isKnown {
+			result[name] = value
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+// marshalKnown marshals the known struct and appends the unknown fields
+// after the known ones, keeping the known fields order intact.
+func marshalKnown(known any, unknown unknownFields) ([]byte, error) {
+	result, err := json.Marshal(known)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unknown) == 0 {
+		return result, nil
+	}
+
+	buf := bytes.NewBuffer(bytes.TrimSuffix(result, []byte("}")))
+
+	names := lo.Keys(unknown)
+	slices.Sort(names)
+
+	for _, name := range names {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		nameBytes, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(nameBytes)
+		buf.WriteByte(':')
+		buf.Write(unknown[name])
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func jsonFieldNames(structType reflect.Type) []string {
+	var result []string
+
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		switch {
+		case name == "-" || !field.IsExported():
+			continue
+		case name == "":
+			result = append(result, field.Name)
+		default:
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
@@ -6,25 +6,34 @@ import (
 	"fmt"
 	"github.com/cirruslabs/vetu/internal/name/simplename"
 	"github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/samber/lo"
+	"math"
 	"runtime"
+	"strings"
 )
 
 var ErrFailedToParse = errors.New("failed to parse VM configuration")
 
-const CurrentVersion = 1
+// CurrentVersion is the latest VM configuration version supported by this vetu,
+// however, the VM configuration is saved with the lowest version that can represent
+// it (see requiredVersion()), so that the older vetu versions can still use it.
+const CurrentVersion = 2
 
 type VMConfig struct {
-	Version    int     `json:"version,omitempty"`
-	Arch       string  `json:"arch,omitempty"`
-	Cmdline    string  `json:"cmdline,omitempty"`
-	Disks      []Disk  `json:"disks,omitempty"`
-	CPUCount   uint8   `json:"cpuCount,omitempty"`
-	MemorySize uint64  `json:"memorySize,omitempty"`
-	MACAddress net.MAC `json:"macAddress,omitempty"`
-}
+	Version    int        `json:"version,omitempty"`
+	Arch       string     `json:"arch,omitempty"`
+	Cmdline    string     `json:"cmdline,omitempty"`
+	Disks      []Disk     `json:"disks,omitempty"`
+	CPUCount   uint16     `json:"cpuCount,omitempty"`
+	CPU        *CPU       `json:"cpu,omitempty"`
+	MemorySize uint64     `json:"memorySize,omitempty"`
+	Memory     *Memory    `json:"memory,omitempty"`
+	NUMANodes  []NUMANode `json:"numaNodes,omitempty"`
+	Balloon    *Balloon   `json:"balloon,omitempty"`
+	Devices    []Device   `json:"devices,omitempty"`
+	MACAddress net.MAC    `json:"macAddress,omitempty"`
 
-type Disk struct {
-	Name string `json:"name"`
+	unknownFields unknownFields
 }
 
 func New() *VMConfig {
@@ -34,27 +43,128 @@ func New() *VMConfig {
 	}
 }
 
+// NewFromJSON parses the VM configuration, migrating
+// it from the older versions to the CurrentVersion.
 func NewFromJSON(vmConfigBytes []byte) (*VMConfig, error) {
+	var versioned struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.Unmarshal(vmConfigBytes, &versioned); err != nil {
+		return nil, err
+	}
+
+	vmConfigBytes, err := migrate(vmConfigBytes, versioned.Version, migrations)
+	if err != nil {
+		return nil, err
+	}
+
 	var vmConfig VMConfig
 
 	if err := json.Unmarshal(vmConfigBytes, &vmConfig); err != nil {
 		return nil, err
 	}
 
-	if vmConfig.Version != CurrentVersion {
-		return nil, fmt.Errorf("%w: only version %d is currently supported, got %d",
-			ErrFailedToParse, CurrentVersion, vmConfig.Version)
+	if err := vmConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedToParse, err)
 	}
 
+	return &vmConfig, nil
+}
+
+// Validate ensures that the VM configuration is consistent
+// and can be passed to Cloud Hypervisor.
+func (vmConfig *VMConfig) Validate() error {
 	if vmConfig.Arch == "" {
-		return nil, fmt.Errorf("%w: architecture field cannot empty", ErrFailedToParse)
+		return errors.New("architecture field cannot empty")
 	}
 
 	for _, disk := range vmConfig.Disks {
 		if err := simplename.Validate(disk.Name); err != nil {
-			return nil, fmt.Errorf("%w: disk name %q %v", ErrFailedToParse, disk.Name, err)
+			return fmt.Errorf("disk name %q %v", disk.Name, err)
+		}
+
+		if err := disk.Validate(); err != nil {
+			return fmt.Errorf("disk %q: %w", disk.Name, err)
 		}
 	}
 
-	return &vmConfig, nil
+	deviceIDs := map[string]struct{}{}
+
+	for _, device := range vmConfig.Devices {
+		if err := device.Validate(); err != nil {
+			return err
+		}
+
+		if device.ID == "" {
+			continue
+		}
+
+		if _, ok := deviceIDs[device.ID]; ok {
+			return fmt.Errorf("%w: device ID %q is used more than once", ErrInvalidDevice, device.ID)
+		}
+
+		deviceIDs[device.ID] = struct{}{}
+	}
+
+	if err := vmConfig.validateCPU(); err != nil {
+		return err
+	}
+
+	return vmConfig.validateMemory()
+}
+
+// CPUAndMemoryArguments renders the VM's CPU, memory, NUMA and balloon
+// configuration as the Cloud Hypervisor's command-line arguments.
+func (vmConfig *VMConfig) CPUAndMemoryArguments() []string {
+	var result []string
+
+	if cpuOptions := vmConfig.cpuOptions(); len(cpuOptions) != 0 {
+		result = append(result, "--cpus", strings.Join(cpuOptions, ","))
+	}
+
+	result = append(result, vmConfig.memoryArguments()...)
+
+	return append(result, vmConfig.balloonArguments()...)
+}
+
+func (vmConfig *VMConfig) UnmarshalJSON(data []byte) error {
+	type plain VMConfig
+
+	unknownFields, err := unmarshalKnown(data, (*plain)(vmConfig))
+	if err != nil {
+		return err
+	}
+
+	vmConfig.unknownFields = unknownFields
+
+	return nil
+}
+
+func (vmConfig VMConfig) MarshalJSON() ([]byte, error) {
+	type plain VMConfig
+
+	vmConfig.Version = vmConfig.requiredVersion()
+
+	return marshalKnown(plain(vmConfig), vmConfig.unknownFields)
+}
+
+// requiredVersion returns the lowest VM configuration version that
+// can represent the VM configuration without older vetu versions
+// ignoring the fields that change how the VM runs.
+func (vmConfig *VMConfig) requiredVersion() int {
+	usesVersion2 := lo.SomeBy(vmConfig.Disks, func(disk Disk) bool {
+		return disk.ReadOnly
+	}) ||
+		(vmConfig.Memory != nil && vmConfig.Memory.Hugepages) ||
+		len(vmConfig.NUMANodes) != 0 ||
+		len(vmConfig.Devices) != 0 ||
+		// Version 1 only supports up to 255 vCPUs
+		vmConfig.CPUCount > math.MaxUint8
+
+	if usesVersion2 {
+		return 2
+	}
+
+	return 1
 }
@@ -1,6 +1,7 @@
 package vmconfig_test
 
 import (
+	"encoding/json"
 	"github.com/cirruslabs/vetu/internal/vmconfig"
 	"github.com/stretchr/testify/require"
 	"os"
@@ -13,8 +14,36 @@ func TestUnsupportedVersion(t *testing.T) {
 	require.NoError(t, err)
 
 	_, err = vmconfig.NewFromJSON(vmConfigBytes)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "only version 1 is currently supported, got 9000")
+	require.ErrorIs(t, err, vmconfig.ErrNewerVersion)
+	require.Contains(t, err.Error(), "got version 9000, but vetu")
+	require.Contains(t, err.Error(), "only supports versions up to 2, please upgrade vetu")
+}
+
+func TestMissingVersion(t *testing.T) {
+	_, err := vmconfig.NewFromJSON([]byte(`{"arch": "amd64"}`))
+	require.ErrorIs(t, err, vmconfig.ErrFailedToParse)
+	require.Contains(t, err.Error(), "unsupported VM configuration version 0")
+}
+
+func TestUnknownFieldsRoundTrip(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "unknown-fields.json"))
+	require.NoError(t, err)
+
+	vmConfig, err := vmconfig.NewFromJSON(vmConfigBytes)
+	require.NoError(t, err)
+
+	// Modifying the known fields should preserve the unknown fields
+	vmConfig.CPUCount = 4
+	vmConfig.Disks = append(vmConfig.Disks, vmconfig.Disk{Name: "data.img"})
+	vmConfig.Balloon.Size = 2 * 1024 * 1024 * 1024
+	vmConfig.Devices[0].ID = "gpu0"
+
+	expectedBytes, err := os.ReadFile(filepath.Join("testdata", "unknown-fields.golden.json"))
+	require.NoError(t, err)
+
+	actualBytes, err := json.Marshal(vmConfig)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expectedBytes), string(actualBytes))
 }
 
 func TestEmptyArchitectureField(t *testing.T) {
@@ -43,3 +72,266 @@ func TestRestrictedDiskName(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "contains restricted characters")
 }
+
+func TestDiskOptions(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "disk-options.json"))
+	require.NoError(t, err)
+
+	vmConfig, err := vmconfig.NewFromJSON(vmConfigBytes)
+	require.NoError(t, err)
+
+	// Disks without options should be rendered as before
+	require.Empty(t, vmConfig.Disks[0].CloudHypervisorOptions())
+
+	require.Equal(t, []string{
+		"readonly=on",
+		"num_queues=4",
+		"serial=data",
+		"image_type=qcow2",
+		"bw_size=10000000",
+		"bw_refill_time=1000",
+	}, vmConfig.Disks[1].CloudHypervisorOptions())
+}
+
+func TestDiskCloudHypervisorArgument(t *testing.T) {
+	disk := vmconfig.Disk{Name: "disk.img"}
+
+	// Disks are sparse by default, so guest's discard
+	// requests punch holes in the disk file
+	require.Equal(t, "path=/vms/vm/disk.img", disk.CloudHypervisorArgument("/vms/vm"))
+
+	require.NoError(t, disk.SetOption("sparse", "off"))
+	require.NoError(t, disk.SetOption("serial", "root"))
+	require.Equal(t, "path=/vms/vm/disk.img,sparse=off,serial=root", disk.CloudHypervisorArgument("/vms/vm"))
+}
+
+func TestDiskSetOption(t *testing.T) {
+	disk := vmconfig.Disk{Name: "disk.img"}
+
+	require.NoError(t, disk.SetOption("direct", "on"))
+	require.NoError(t, disk.SetOption("sparse", "off"))
+	require.NoError(t, disk.SetOption("queue_size", "256"))
+	require.NoError(t, disk.SetOption("ops_size", "1000"))
+	require.NoError(t, disk.SetOption("ops_refill_time", "1000"))
+	require.NoError(t, disk.Validate())
+	require.NoError(t, disk.SetOption("bw_size", "10MB"))
+
+	require.Equal(t, []string{
+		"direct=on",
+		"sparse=off",
+		"queue_size=256",
+		"bw_size=10000000",
+		"bw_refill_time=0",
+		"ops_size=1000",
+		"ops_refill_time=1000",
+	}, disk.CloudHypervisorOptions())
+
+	// Disks are sparse by default, so enabling the option explicitly is a no-op
+	require.NoError(t, disk.SetOption("sparse", "on"))
+	require.NotContains(t, disk.CloudHypervisorOptions(), "sparse=on")
+	require.NotContains(t, disk.CloudHypervisorOptions(), "sparse=off")
+	require.NoError(t, disk.SetOption("sparse", ""))
+	require.Nil(t, disk.Sparse)
+
+	// Incomplete rate limit should be rejected
+	require.ErrorIs(t, disk.Validate(), vmconfig.ErrInvalidDiskOption)
+
+	// Resetting the rate limit fields should remove the rate limit
+	require.NoError(t, disk.SetOption("bw_size", ""))
+	require.NoError(t, disk.SetOption("ops_size", ""))
+	require.NoError(t, disk.SetOption("ops_refill_time", ""))
+	require.Nil(t, disk.RateLimit)
+
+	require.ErrorIs(t, disk.SetOption("readonly", "maybe"), vmconfig.ErrInvalidDiskOption)
+	require.ErrorIs(t, disk.SetOption("cache", "on"), vmconfig.ErrInvalidDiskOption)
+
+	require.NoError(t, disk.SetOption("queue_size", "100"))
+	require.ErrorIs(t, disk.Validate(), vmconfig.ErrInvalidDiskOption)
+	require.NoError(t, disk.SetOption("queue_size", ""))
+
+	// Serial cannot break the Cloud Hypervisor's --disk parameters
+	for _, serial := range []string{"a,b", "a=b"} {
+		disk.Serial = serial
+		require.ErrorIs(t, disk.Validate(), vmconfig.ErrInvalidDiskOption)
+	}
+}
+
+func TestInvalidDiskImageType(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "invalid-disk-image-type.json"))
+	require.NoError(t, err)
+
+	_, err = vmconfig.NewFromJSON(vmConfigBytes)
+	require.ErrorIs(t, err, vmconfig.ErrFailedToParse)
+	require.Contains(t, err.Error(), "unsupported image type")
+}
+
+func TestCPUAndMemoryArguments(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "cpu-memory-options.json"))
+	require.NoError(t, err)
+
+	vmConfig, err := vmconfig.NewFromJSON(vmConfigBytes)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"--cpus", "boot=300,max=512,topology=2:16:1:16,affinity=[0@[0,1],1@[2,3]]",
+		"--memory", "size=0",
+		"--memory-zone",
+		"id=mem0,size=4294967296,shared=on,hugepages=on,hugepage_size=2097152",
+		"id=mem1,size=2147483648,shared=on,hugepages=on,hugepage_size=2097152",
+		"--numa",
+		"guest_numa_id=0,cpus=[0,1,2,3],distances=[1@20],memory_zones=mem0",
+		"guest_numa_id=1,cpus=[4,5,6,7],memory_zones=mem1",
+	}, vmConfig.CPUAndMemoryArguments())
+
+	// CPU count and memory size should be rendered as before
+	require.Equal(t, []string{"--cpus", "boot=2", "--memory", "size=4294967296"},
+		(&vmconfig.VMConfig{CPUCount: 2, MemorySize: 4294967296}).CPUAndMemoryArguments())
+	require.Empty(t, vmconfig.New().CPUAndMemoryArguments())
+}
+
+func TestInvalidCPUTopology(t *testing.T) {
+	vmConfigBytes, err := os.ReadFile(filepath.Join("testdata", "invalid-cpu-topology.json"))
+	require.NoError(t, err)
+
+	_, err = vmconfig.NewFromJSON(vmConfigBytes)
+	require.ErrorIs(t, err, vmconfig.ErrFailedToParse)
+	require.Contains(t, err.Error(), "CPU topology 2:4:1:1 describes 8 vCPUs, but the VM has up to 4 vCPUs")
+}
+
+func TestInvalidNUMANodes(t *testing.T) {
+	vmConfig := vmconfig.New()
+	vmConfig.CPUCount = 4
+	vmConfig.MemorySize = 4 * 1024 * 1024 * 1024
+
+	for _, rawNUMANode := range []string{"0:0-1:2GiB:1@20", "1:2-3:2GiB"} {
+		numaNode, err := vmconfig.ParseNUMANode(rawNUMANode)
+		require.NoError(t, err)
+
+		vmConfig.NUMANodes = append(vmConfig.NUMANodes, numaNode)
+	}
+	require.NoError(t, vmConfig.Validate())
+
+	// Memory size should match the NUMA nodes memory
+	vmConfig.MemorySize = 8 * 1024 * 1024 * 1024
+	require.ErrorContains(t, vmConfig.Validate(), "NUMA nodes have 4.0 GiB of memory in total")
+	vmConfig.MemorySize = 0
+
+	// vCPUs cannot belong to multiple NUMA nodes
+	vmConfig.NUMANodes[1].CPUs = []uint16{1, 2}
+	require.ErrorContains(t, vmConfig.Validate(), "vCPU 1 belongs to both NUMA nodes 0 and 1")
+	vmConfig.NUMANodes[1].CPUs = []uint16{4}
+	require.ErrorContains(t, vmConfig.Validate(), "references vCPU 4, but the VM has up to 4 vCPUs")
+
+	_, err := vmconfig.ParseNUMANode("0:0-1")
+	require.ErrorIs(t, err, vmconfig.ErrInvalidMemoryOption)
+}
+
+func TestCPUList(t *testing.T) {
+	cpus, err := vmconfig.ParseCPUList("8,0-3,2")
+	require.NoError(t, err)
+	require.Equal(t, []uint16{0, 1, 2, 3, 8}, cpus)
+	require.Equal(t, "0-3,8", vmconfig.FormatCPUList(cpus))
+
+	_, err = vmconfig.ParseCPUList("3-1")
+	require.Error(t, err)
+
+	_, err = vmconfig.ParseCPUList("")
+	require.Error(t, err)
+}
+
+func TestBalloon(t *testing.T) {
+	vmConfig := vmconfig.New()
+	vmConfig.MemorySize = 4 * 1024 * 1024 * 1024
+	vmConfig.Balloon = &vmconfig.Balloon{
+		DeflateOnOOM:      true,
+		FreePageReporting: true,
+	}
+	require.NoError(t, vmConfig.Validate())
+
+	require.Equal(t, []string{
+		"--memory", "size=4294967296",
+		"--balloon", "size=0,deflate_on_oom=on,free_page_reporting=on",
+	}, vmConfig.CPUAndMemoryArguments())
+
+	vmConfig.Balloon.Size = 8 * 1024 * 1024 * 1024
+	require.ErrorIs(t, vmConfig.Validate(), vmconfig.ErrInvalidMemoryOption)
+}
+
+func TestMemoryHotplug(t *testing.T) {
+	vmConfig := vmconfig.New()
+	vmConfig.MemorySize = 4 * 1024 * 1024 * 1024
+	vmConfig.Memory = &vmconfig.Memory{
+		HotplugSize:   8 * 1024 * 1024 * 1024,
+		HotplugMethod: vmconfig.HotplugMethodVirtioMem,
+	}
+	require.NoError(t, vmConfig.Validate())
+
+	require.Equal(t, []string{
+		"--memory", "size=4294967296,hotplug_size=8589934592,hotplug_method=virtio-mem",
+	}, vmConfig.CPUAndMemoryArguments())
+
+	vmConfig.Memory.HotplugMethod = "dimm"
+	require.ErrorIs(t, vmConfig.Validate(), vmconfig.ErrInvalidMemoryOption)
+
+	vmConfig.Memory.HotplugMethod = vmconfig.HotplugMethodACPI
+	vmConfig.NUMANodes = []vmconfig.NUMANode{{CPUs: []uint16{0}, MemorySize: 4 * 1024 * 1024 * 1024}}
+	require.ErrorIs(t, vmConfig.Validate(), vmconfig.ErrInvalidMemoryOption)
+}
+
+func TestDevices(t *testing.T) {
+	device, err := vmconfig.ParseDevice("01:00.0")
+	require.NoError(t, err)
+	require.Equal(t, vmconfig.Device{Path: "/sys/bus/pci/devices/0000:01:00.0/"}, device)
+
+	bdf, ok := device.BDF()
+	require.True(t, ok)
+	require.Equal(t, "0000:01:00.0", bdf)
+
+	device, err = vmconfig.ParseDevice("path=/sys/bus/pci/devices/0000:02:00.0/,iommu=on,pci_segment=1,id=gpu0")
+	require.NoError(t, err)
+	require.Equal(t, vmconfig.Device{
+		Path:       "/sys/bus/pci/devices/0000:02:00.0/",
+		IOMMU:      true,
+		PCISegment: 1,
+		ID:         "gpu0",
+	}, device)
+	require.Equal(t, "path=/sys/bus/pci/devices/0000:02:00.0/,iommu=on,pci_segment=1,id=gpu0", device.String())
+
+	// Mediated devices are not PCI devices
+	device, err = vmconfig.ParseDevice("path=/sys/bus/mdev/devices/c2e088c3-4e5a-4d8b-a2d3-7e4b9c4e2f10/")
+	require.NoError(t, err)
+	_, ok = device.BDF()
+	require.False(t, ok)
+
+	// Cloud Hypervisor also accepts true/false
+	device, err = vmconfig.ParseDevice("path=/sys/bus/pci/devices/0000:02:00.0/,iommu=true")
+	require.NoError(t, err)
+	require.True(t, device.IOMMU)
+	require.Equal(t, "path=/sys/bus/pci/devices/0000:02:00.0/,iommu=on", device.String())
+
+	device, err = vmconfig.ParseDevice("path=/sys/bus/pci/devices/0000:02:00.0/,iommu=false")
+	require.NoError(t, err)
+	require.False(t, device.IOMMU)
+
+	// Unknown options should be passed to the Cloud Hypervisor as is
+	device, err = vmconfig.ParseDevice("path=/sys/bus/pci/devices/0000:03:00.0/,x_nv_gpudirect_clique=0,id=gpu1")
+	require.NoError(t, err)
+	require.Equal(t, vmconfig.Device{
+		Path:    "/sys/bus/pci/devices/0000:03:00.0/",
+		ID:      "gpu1",
+		Options: []string{"x_nv_gpudirect_clique=0"},
+	}, device)
+	require.Equal(t, "path=/sys/bus/pci/devices/0000:03:00.0/,id=gpu1,x_nv_gpudirect_clique=0", device.String())
+
+	for _, invalid := range []string{"iommu=on", "path=/x,iommu=yes", "path=/x,bar", "/x"} {
+		_, err := vmconfig.ParseDevice(invalid)
+		require.ErrorIs(t, err, vmconfig.ErrInvalidDevice, invalid)
+	}
+
+	vmConfig := vmconfig.New()
+	vmConfig.Devices = []vmconfig.Device{
+		{Path: "/sys/bus/pci/devices/0000:01:00.0/", ID: "gpu0"},
+		{Path: "/sys/bus/pci/devices/0000:02:00.0/", ID: "gpu0"},
+	}
+	require.ErrorIs(t, vmConfig.Validate(), vmconfig.ErrInvalidDevice)
+}
@@ -0,0 +1,37 @@
+package vmdirectory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cirruslabs/vetu/internal/externalcommand/cloudhypervisor"
+)
+
+var ErrAPIUnavailable = errors.New("VM's Cloud Hypervisor API is not available")
+
+// MaxAPISocketPathLength is the maximum length of the UNIX socket path
+// on Linux, which is limited by the sockaddr_un's sun_path field size.
+const MaxAPISocketPathLength = 107
+
+// APISocketPath returns the path to the UNIX socket that
+// exposes the Cloud Hypervisor's API of the running VM.
+func (vmDir *VMDirectory) APISocketPath() string {
+	return filepath.Join(vmDir.baseDir, ".api.sock")
+}
+
+// API returns the Cloud Hypervisor's API client of the running VM.
+func (vmDir *VMDirectory) API() (*cloudhypervisor.APIClient, error) {
+	if !vmDir.Running() {
+		return nil, fmt.Errorf("%w: VM is not running", ErrAPIUnavailable)
+	}
+
+	if _, err := os.Stat(vmDir.APISocketPath()); err != nil {
+		return nil, fmt.Errorf("%w: %v (note that the VMs with the paths longer than %d characters, "+
+			"and the VMs started by older vetu versions have no API socket)", ErrAPIUnavailable, err,
+			MaxAPISocketPathLength)
+	}
+
+	return cloudhypervisor.NewAPIClient(vmDir.APISocketPath()), nil
+}
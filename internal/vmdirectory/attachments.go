@@ -0,0 +1,77 @@
+package vmdirectory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+type AttachmentKind string
+
+const (
+	AttachmentKindDisk   AttachmentKind = "disk"
+	AttachmentKindDevice AttachmentKind = "device"
+)
+
+// Attachment describes a disk or a device that was hotplugged
+// into the running VM using "vetu attach".
+type Attachment struct {
+	// ID is the Cloud Hypervisor's device ID, which is used to detach the device
+	ID string `json:"id"`
+
+	Kind AttachmentKind `json:"kind"`
+
+	// Path is the path to the disk image or the device's sysfs directory
+	Path string `json:"path"`
+
+	// BDF is the device's PCI address in the guest
+	BDF string `json:"bdf,omitempty"`
+}
+
+// Attachments returns the disks and the devices attached to the running VM.
+//
+// Attachments only live as long as the Cloud Hypervisor process, so
+// "vetu run" resets them when the VM starts and when the VM stops.
+func (vmDir *VMDirectory) Attachments() ([]Attachment, error) {
+	attachmentsBytes, err := os.ReadFile(vmDir.attachmentsFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var attachments []Attachment
+
+	if err := json.Unmarshal(attachmentsBytes, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (vmDir *VMDirectory) SetAttachments(attachments []Attachment) error {
+	if len(attachments) == 0 {
+		return vmDir.ResetAttachments()
+	}
+
+	attachmentsBytes, err := json.Marshal(attachments)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(vmDir.attachmentsFilePath(), attachmentsBytes, 0600)
+}
+
+func (vmDir *VMDirectory) ResetAttachments() error {
+	if err := os.Remove(vmDir.attachmentsFilePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (vmDir *VMDirectory) attachmentsFilePath() string {
+	return filepath.Join(vmDir.baseDir, ".attachments.json")
+}
@@ -0,0 +1,50 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	// By default, the VM directory shouldn't have any attachments
+	attachments, err := vmDir.Attachments()
+	require.NoError(t, err)
+	require.Empty(t, attachments)
+
+	// Set the attachments and ensure that they're read back the same
+	expectedAttachments := []vmdirectory.Attachment{
+		{
+			ID:   "_disk2",
+			Kind: vmdirectory.AttachmentKindDisk,
+			Path: "/var/lib/scratch.img",
+			BDF:  "0000:00:06.0",
+		},
+		{
+			ID:   "gpu0",
+			Kind: vmdirectory.AttachmentKindDevice,
+			Path: "/sys/bus/pci/devices/0000:01:00.0/",
+			BDF:  "0000:00:07.0",
+		},
+	}
+
+	require.NoError(t, vmDir.SetAttachments(expectedAttachments))
+
+	attachments, err = vmDir.Attachments()
+	require.NoError(t, err)
+	require.Equal(t, expectedAttachments, attachments)
+
+	// Setting no attachments should reset them
+	require.NoError(t, vmDir.SetAttachments(nil))
+
+	attachments, err = vmDir.Attachments()
+	require.NoError(t, err)
+	require.Empty(t, attachments)
+
+	// Resetting the already reset attachments should be a no-op
+	require.NoError(t, vmDir.ResetAttachments())
+}
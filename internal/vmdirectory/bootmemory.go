@@ -0,0 +1,66 @@
+package vmdirectory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// BootMemory describes the memory that the running VM was started with.
+//
+// Cloud Hypervisor grows the VM's memory size on ACPI memory hotplug,
+// so this is the only way to know how much memory can still be hotplugged.
+type BootMemory struct {
+	Size        uint64 `json:"size"`
+	HotplugSize uint64 `json:"hotplugSize"`
+}
+
+// MaxSize returns the maximum memory size that the running VM can be resized to.
+func (bootMemory *BootMemory) MaxSize() uint64 {
+	return bootMemory.Size + bootMemory.HotplugSize
+}
+
+// BootMemory returns the memory that the running VM was started with,
+// or nil if it wasn't recorded (e.g. when the VM was started by an older
+// vetu version).
+//
+// Like the attachments, "vetu run" resets it when the VM starts and stops.
+func (vmDir *VMDirectory) BootMemory() (*BootMemory, error) {
+	bootMemoryBytes, err := os.ReadFile(vmDir.bootMemoryFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var bootMemory BootMemory
+
+	if err := json.Unmarshal(bootMemoryBytes, &bootMemory); err != nil {
+		return nil, err
+	}
+
+	return &bootMemory, nil
+}
+
+func (vmDir *VMDirectory) SetBootMemory(bootMemory BootMemory) error {
+	bootMemoryBytes, err := json.Marshal(bootMemory)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(vmDir.bootMemoryFilePath(), bootMemoryBytes, 0600)
+}
+
+func (vmDir *VMDirectory) ResetBootMemory() error {
+	if err := os.Remove(vmDir.bootMemoryFilePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (vmDir *VMDirectory) bootMemoryFilePath() string {
+	return filepath.Join(vmDir.baseDir, ".boot-memory.json")
+}
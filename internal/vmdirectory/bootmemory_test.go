@@ -0,0 +1,40 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBootMemory(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	// By default, the boot memory shouldn't be recorded
+	bootMemory, err := vmDir.BootMemory()
+	require.NoError(t, err)
+	require.Nil(t, bootMemory)
+
+	// Set the boot memory and ensure that it's read back the same
+	expectedBootMemory := vmdirectory.BootMemory{
+		Size:        4 * 1024 * 1024 * 1024,
+		HotplugSize: 2 * 1024 * 1024 * 1024,
+	}
+
+	require.NoError(t, vmDir.SetBootMemory(expectedBootMemory))
+
+	bootMemory, err = vmDir.BootMemory()
+	require.NoError(t, err)
+	require.Equal(t, &expectedBootMemory, bootMemory)
+	require.EqualValues(t, 6*1024*1024*1024, bootMemory.MaxSize())
+
+	require.NoError(t, vmDir.ResetBootMemory())
+
+	bootMemory, err = vmDir.BootMemory()
+	require.NoError(t, err)
+	require.Nil(t, bootMemory)
+
+	// Resetting the already reset boot memory should be a no-op
+	require.NoError(t, vmDir.ResetBootMemory())
+}
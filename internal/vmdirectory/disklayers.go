@@ -0,0 +1,76 @@
+package vmdirectory
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// DiskLayer describes an uncompressed region of the VM's disk
+// that was populated from a single OCI layer when pulling.
+type DiskLayer struct {
+	Disk   string        `json:"disk"`
+	Offset int64         `json:"offset"`
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// DiskLayers returns the disk layers recorded when pulling the VM,
+// or nil if the VM was not pulled or was pulled by an older Vetu version.
+func (vmDir *VMDirectory) DiskLayers() ([]DiskLayer, error) {
+	diskLayersBytes, err := os.ReadFile(vmDir.diskLayersFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var diskLayers []DiskLayer
+
+	if err := json.Unmarshal(diskLayersBytes, &diskLayers); err != nil {
+		return nil, err
+	}
+
+	return diskLayers, nil
+}
+
+func (vmDir *VMDirectory) SetDiskLayers(diskLayers []DiskLayer) error {
+	diskLayersBytes, err := json.Marshal(diskLayers)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(vmDir.diskLayersFilePath(), diskLayersBytes, 0600)
+}
+
+// DiskLayerDigest calculates the actual digest of the disk region
+// described by the disk layer, so that it can be compared against
+// the digest that was recorded when pulling.
+func (vmDir *VMDirectory) DiskLayerDigest(diskLayer DiskLayer) (digest.Digest, error) {
+	if err := diskLayer.Digest.Validate(); err != nil {
+		return "", err
+	}
+
+	diskFile, err := os.Open(filepath.Join(vmDir.baseDir, diskLayer.Disk))
+	if err != nil {
+		return "", err
+	}
+	defer diskFile.Close()
+
+	digester := diskLayer.Digest.Algorithm().Digester()
+
+	if _, err := io.Copy(digester.Hash(), io.NewSectionReader(diskFile, diskLayer.Offset, diskLayer.Size)); err != nil {
+		return "", err
+	}
+
+	return digester.Digest(), nil
+}
+
+func (vmDir *VMDirectory) diskLayersFilePath() string {
+	return filepath.Join(vmDir.baseDir, ".disk-layers.json")
+}
@@ -0,0 +1,49 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskLayers(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	// By default, the VM directory shouldn't have any disk layers recorded
+	diskLayers, err := vmDir.DiskLayers()
+	require.NoError(t, err)
+	require.Empty(t, diskLayers)
+
+	// Record the disk layers and ensure that they're read back the same
+	expectedDiskLayers := []vmdirectory.DiskLayer{
+		{Disk: "disk.img", Offset: 0, Size: 10, Digest: digest.FromString("first")},
+		{Disk: "disk.img", Offset: 10, Size: 5, Digest: digest.FromString("second")},
+	}
+
+	require.NoError(t, vmDir.SetDiskLayers(expectedDiskLayers))
+
+	diskLayers, err = vmDir.DiskLayers()
+	require.NoError(t, err)
+	require.Equal(t, expectedDiskLayers, diskLayers)
+}
+
+func TestDiskLayerDigest(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(vmDir.Path(), "disk.img"), []byte("firstsecond"), 0600))
+
+	actualDigest, err := vmDir.DiskLayerDigest(vmdirectory.DiskLayer{
+		Disk:   "disk.img",
+		Offset: 5,
+		Size:   6,
+		Digest: digest.FromString("second"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, digest.FromString("second"), actualDigest)
+}
@@ -0,0 +1,44 @@
+package vmdirectory
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LastAccessed returns the time when the VM was last cloned or run,
+// falling back to the time when its configuration was last modified
+// for the VMs that were never accessed since the time they were created.
+func (vmDir *VMDirectory) LastAccessed() (time.Time, error) {
+	fileInfo, err := os.Stat(vmDir.lastAccessedFilePath())
+	if err == nil {
+		return fileInfo.ModTime(), nil
+	}
+	if !os.IsNotExist(err) {
+		return time.Time{}, err
+	}
+
+	fileInfo, err = os.Stat(vmDir.ConfigPath())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fileInfo.ModTime(), nil
+}
+
+func (vmDir *VMDirectory) SetLastAccessed(lastAccessed time.Time) error {
+	file, err := os.OpenFile(vmDir.lastAccessedFilePath(), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(vmDir.lastAccessedFilePath(), lastAccessed, lastAccessed)
+}
+
+func (vmDir *VMDirectory) lastAccessedFilePath() string {
+	return filepath.Join(vmDir.baseDir, ".last-accessed")
+}
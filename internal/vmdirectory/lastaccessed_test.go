@@ -0,0 +1,35 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmconfig"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLastAccessed(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	require.NoError(t, vmDir.SetConfig(vmconfig.New()))
+
+	// By default, the last accessed time should be the time
+	// when the VM's configuration was last modified
+	configFileInfo, err := os.Stat(vmDir.ConfigPath())
+	require.NoError(t, err)
+
+	lastAccessed, err := vmDir.LastAccessed()
+	require.NoError(t, err)
+	require.Equal(t, configFileInfo.ModTime(), lastAccessed)
+
+	// Set the last accessed time and ensure that it's read back the same
+	expectedLastAccessed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, vmDir.SetLastAccessed(expectedLastAccessed))
+
+	lastAccessed, err = vmDir.LastAccessed()
+	require.NoError(t, err)
+	require.True(t, expectedLastAccessed.Equal(lastAccessed))
+}
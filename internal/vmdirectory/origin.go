@@ -0,0 +1,60 @@
+package vmdirectory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Origin describes the remote VM image that the VM was pulled or cloned from.
+type Origin struct {
+	// RemoteName is the remote name that was used when pulling or cloning
+	// the VM, which may refer to the VM image by tag
+	RemoteName string `json:"remoteName"`
+
+	// Digest is the digest that the RemoteName was resolved to
+	Digest digest.Digest `json:"digest"`
+
+	// PullTime is when the VM image was pulled, zero if unknown
+	PullTime time.Time `json:"pullTime"`
+
+	// VetuVersion is the version of Vetu that pulled the VM image
+	VetuVersion string `json:"vetuVersion,omitempty"`
+}
+
+// Origin returns the origin of the VM, or nil if the VM was created
+// locally or pulled by an older Vetu version.
+func (vmDir *VMDirectory) Origin() (*Origin, error) {
+	originBytes, err := os.ReadFile(vmDir.originFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var origin Origin
+
+	if err := json.Unmarshal(originBytes, &origin); err != nil {
+		return nil, err
+	}
+
+	return &origin, nil
+}
+
+func (vmDir *VMDirectory) SetOrigin(origin *Origin) error {
+	originBytes, err := json.Marshal(origin)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(vmDir.originFilePath(), originBytes, 0600)
+}
+
+func (vmDir *VMDirectory) originFilePath() string {
+	return filepath.Join(vmDir.baseDir, ".origin.json")
+}
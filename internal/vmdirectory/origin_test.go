@@ -0,0 +1,34 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/storage/temporary"
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOrigin(t *testing.T) {
+	vmDir, err := temporary.Create()
+	require.NoError(t, err)
+
+	// By default, the VM directory shouldn't have an origin
+	origin, err := vmDir.Origin()
+	require.NoError(t, err)
+	require.Nil(t, origin)
+
+	// Set the origin and ensure that it's read back the same
+	expectedOrigin := &vmdirectory.Origin{
+		RemoteName:  "ghcr.io/cirruslabs/ubuntu:latest",
+		Digest:      digest.FromString("manifest"),
+		PullTime:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		VetuVersion: "1.2.3",
+	}
+
+	require.NoError(t, vmDir.SetOrigin(expectedOrigin))
+
+	origin, err = vmDir.Origin()
+	require.NoError(t, err)
+	require.Equal(t, expectedOrigin, origin)
+}
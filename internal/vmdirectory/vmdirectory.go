@@ -3,12 +3,14 @@ package vmdirectory
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/cirruslabs/vetu/internal/diskusage"
 	"github.com/cirruslabs/vetu/internal/filelock"
 	"github.com/cirruslabs/vetu/internal/pidlock"
 	"github.com/cirruslabs/vetu/internal/vmconfig"
-	"io/fs"
+	"golang.org/x/sys/unix"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type VMDirectory struct {
@@ -42,41 +44,44 @@ func (vmDir *VMDirectory) Path() string {
 	return vmDir.baseDir
 }
 
-func (vmDir *VMDirectory) Size() (uint64, error) {
-	var result uint64
-
-	if err := filepath.WalkDir(vmDir.Path(), func(path string, dirEntry fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		fileInfo, err := dirEntry.Info()
-		if err != nil {
-			return err
-		}
+// DiskUsage returns the apparent and the allocated size of the VM directory's files,
+// the latter is smaller than the former for sparse files (e.g. disks) and when
+// the files share the extents (e.g. when cloned using reflinks).
+func (vmDir *VMDirectory) DiskUsage() (diskusage.Usage, error) {
+	return diskusage.Of(vmDir.Path())
+}
 
-		result += uint64(fileInfo.Size())
+// FileSize returns the apparent and the allocated size of the file in the VM directory,
+// the latter is smaller than the former for sparse files (e.g. disks).
+func (vmDir *VMDirectory) FileSize(name string) (uint64, uint64, error) {
+	var stat unix.Stat_t
 
-		return nil
-	}); err != nil {
-		return 0, err
+	if err := unix.Stat(filepath.Join(vmDir.baseDir, name), &stat); err != nil {
+		return 0, 0, err
 	}
 
-	return result, nil
+	// st_blocks is always expressed in 512-byte units
+	return uint64(stat.Size), uint64(stat.Blocks) * 512, nil
 }
 
 func (vmDir *VMDirectory) Running() bool {
+	return vmDir.PID() != 0
+}
+
+// PID returns the PID of the "vetu run" process that runs the VM,
+// or zero if the VM is not running.
+func (vmDir *VMDirectory) PID() int32 {
 	lock, err := pidlock.New(vmDir.ConfigPath())
 	if err != nil {
-		return false
+		return 0
 	}
 
 	pid, err := lock.Pid()
 	if err != nil {
-		return false
+		return 0
 	}
 
-	return pid != 0
+	return pid
 }
 
 func (vmDir *VMDirectory) State() State {
@@ -87,6 +92,18 @@ func (vmDir *VMDirectory) State() State {
 	}
 }
 
+// IsReservedName returns true if the file name is used by the VM directory
+// itself (e.g. "config.json" or the dot-prefixed bookkeeping files like
+// ".disk-layers.json"), and thus cannot be used for the VM's disks.
+func IsReservedName(name string) bool {
+	switch name {
+	case "config.json", "kernel", "initramfs":
+		return true
+	default:
+		return strings.HasPrefix(name, ".")
+	}
+}
+
 func (vmDir *VMDirectory) ConfigPath() string {
 	return filepath.Join(vmDir.baseDir, "config.json")
 }
@@ -0,0 +1,17 @@
+package vmdirectory_test
+
+import (
+	"github.com/cirruslabs/vetu/internal/vmdirectory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIsReservedName(t *testing.T) {
+	for _, name := range []string{"config.json", "kernel", "initramfs", ".disk-layers.json", ".attachments.json"} {
+		require.True(t, vmdirectory.IsReservedName(name), name)
+	}
+
+	for _, name := range []string{"disk.img", "disk1.img", "kernel.img", "data"} {
+		require.False(t, vmdirectory.IsReservedName(name), name)
+	}
+}
@@ -7,3 +7,12 @@ import (
 func Clone(destFd int, srcFd int) error {
 	return unix.IoctlFileClone(destFd, srcFd)
 }
+
+func CloneRange(destFd int, destOffset int64, srcFd int, srcOffset int64, length int64) error {
+	return unix.IoctlFileCloneRange(destFd, &unix.FileCloneRange{
+		Src_fd:      int64(srcFd),
+		Src_offset:  uint64(srcOffset),
+		Src_length:  uint64(length),
+		Dest_offset: uint64(destOffset),
+	})
+}
@@ -7,3 +7,7 @@ import "golang.org/x/sys/unix"
 func Clone(destFd int, srcFd int) error {
 	return unix.ENOTSUP
 }
+
+func CloneRange(destFd int, destOffset int64, srcFd int, srcOffset int64, length int64) error {
+	return unix.ENOTSUP
+}